@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log/slog"
 	"os"
-	"strings"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/generator"
 )
 
 func main() {
@@ -13,20 +16,22 @@ func main() {
 	flag.StringVar(&projectPath, "project", "/tedium/repo", "Project path to target")
 	flag.Parse()
 
-	projectPath = strings.TrimRight(projectPath, "/")
+	opts := generator.Options{
+		PrivateGitDomain: os.Getenv("PRIVATE_GIT_DOMAIN"),
+		PlatformType:     os.Getenv("TEDIUM_PLATFORM_TYPE"),
+		DefaultBranch:    os.Getenv("TEDIUM_REPO_DEFAULT_BRANCH"),
+		Config:           config.FromEnv(os.Environ()),
+	}
 
-	stat, err := os.Stat(projectPath)
+	result, err := generator.Generate(context.Background(), projectPath, opts)
 	if err != nil {
-		slog.Error("Error stating project path", "error", err)
+		slog.Error("error generating tasks and CI config", "error", err)
 		os.Exit(1)
 	}
 
-	if !stat.IsDir() {
-		slog.Error("Project path doesn't exist or isn't a directory")
+	err = result.Apply(projectPath)
+	if err != nil {
+		slog.Error("error writing generated files", "error", err)
 		os.Exit(1)
 	}
-
-	updateTaskfile(projectPath)
-	updateCIConfig(projectPath)
-	deleteOldCIConfigs(projectPath)
 }
@@ -3,28 +3,111 @@ package ci
 import (
 	"bytes"
 	"fmt"
-	"os"
-	"regexp"
+	"maps"
+	"path"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-const ActionsCiFilePath = ".circleci/config.yml"
+const (
+	GitHubActionsCiFilePath  = ".github/workflows/ci.yml"
+	ForgejoActionsCiFilePath = ".forgejo/workflows/ci.yml"
+)
+
+// the defaults will slowly get out of date, but they will only be applied to first-time CI and Renovate will update them anyway
+const (
+	defaultCIResourcesAction = "markormesher/ci-resources/setup@v0.6.0"
+	defaultCacheAction       = "actions/cache@v4"
+	defaultCheckoutAction    = "actions/checkout@v4"
+
+	defaultGitHubUploadArtifactAction   = "actions/upload-artifact@v4"
+	defaultGitHubDownloadArtifactAction = "actions/download-artifact@v4"
+	// Forgejo's artifact storage isn't compatible with v4 of the GitHub actions
+	defaultForgejoUploadArtifactAction   = "https://code.forgejo.org/forgejo/upload-artifact@v4"
+	defaultForgejoDownloadArtifactAction = "https://code.forgejo.org/forgejo/download-artifact@v4"
+)
 
 type ActionsConfig struct {
-	Name string                      `yaml:"name,omitempty"`
-	On   []string                    `yaml:"on"`
-	Jobs map[string]ActionsJobConfig `yaml:"jobs"`
+	Name        string                      `yaml:"name,omitempty"`
+	On          ActionsTriggers             `yaml:"on"`
+	Concurrency *ActionsConcurrencyConfig   `yaml:"concurrency,omitempty"`
+	Jobs        map[string]ActionsJobConfig `yaml:"jobs"`
+}
+
+// ActionsConcurrencyConfig limits runs in the same group to one at a time. CancelInProgress may be an expression, so it is kept as a string.
+type ActionsConcurrencyConfig struct {
+	Group            string `yaml:"group"`
+	CancelInProgress string `yaml:"cancel-in-progress,omitempty"`
+}
+
+type ActionsTriggers struct {
+	Push             *ActionsPushTrigger             `yaml:"push,omitempty"`
+	PullRequest      *ActionsPullRequestTrigger      `yaml:"pull_request,omitempty"`
+	Schedule         []ActionsScheduleTrigger        `yaml:"schedule,omitempty"`
+	WorkflowDispatch *ActionsWorkflowDispatchTrigger `yaml:"workflow_dispatch,omitempty"`
+}
+
+type ActionsPushTrigger struct {
+	Branches []string `yaml:"branches,omitempty"`
+	Tags     []string `yaml:"tags,omitempty"`
+}
+
+type ActionsPullRequestTrigger struct {
+	Branches []string `yaml:"branches,omitempty"`
+}
+
+type ActionsScheduleTrigger struct {
+	Cron string `yaml:"cron"`
+}
+
+type ActionsWorkflowDispatchTrigger struct{}
+
+// UnmarshalYAML accepts the short forms of "on" (a single event name or a list of them) as well as the full mapping.
+func (t *ActionsTriggers) UnmarshalYAML(node *yaml.Node) error {
+	events := []string{}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		events = append(events, node.Value)
+
+	case yaml.SequenceNode:
+		err := node.Decode(&events)
+		if err != nil {
+			return err
+		}
+
+	default:
+		type plain ActionsTriggers
+		return node.Decode((*plain)(t))
+	}
+
+	for _, e := range events {
+		switch e {
+		case "push":
+			t.Push = &ActionsPushTrigger{}
+		case "pull_request":
+			t.PullRequest = &ActionsPullRequestTrigger{}
+		case "workflow_dispatch":
+			t.WorkflowDispatch = &ActionsWorkflowDispatchTrigger{}
+		}
+	}
+
+	return nil
 }
 
 type ActionsJobConfig struct {
-	RunsOn        string                    `yaml:"runs-on"`
-	If            string                    `yaml:"if,omitempty"`
-	Needs         []*regexp.Regexp          `yaml:"-"`
-	ResolvedNeeds []string                  `yaml:"needs,omitempty"`
-	Permissions   map[string]string         `yaml:"permissions,omitempty"`
-	Container     ActionsJobContainerConfig `yaml:"container,omitempty"`
-	Steps         []ActionsJobStepConfig    `yaml:"steps"`
+	RunsOn          string                    `yaml:"runs-on"`
+	If              string                    `yaml:"if,omitempty"`
+	Needs           []string                  `yaml:"needs,omitempty"`
+	TimeoutMinutes  int                       `yaml:"timeout-minutes,omitempty"`
+	ContinueOnError bool                      `yaml:"continue-on-error,omitempty"`
+	Concurrency     *ActionsConcurrencyConfig `yaml:"concurrency,omitempty"`
+	Permissions     map[string]string         `yaml:"permissions,omitempty"`
+	Container       ActionsJobContainerConfig `yaml:"container,omitempty"`
+	Environment     map[string]string         `yaml:"env,omitempty"`
+	Outputs         map[string]string         `yaml:"outputs,omitempty"`
+	Steps           []ActionsJobStepConfig    `yaml:"steps"`
 }
 
 type ActionsJobContainerConfig struct {
@@ -32,33 +115,365 @@ type ActionsJobContainerConfig struct {
 }
 
 type ActionsJobStepConfig struct {
+	ID          string            `yaml:"id,omitempty"`
 	Name        string            `yaml:"name,omitempty"`
+	If          string            `yaml:"if,omitempty"`
 	Shell       string            `yaml:"shell,omitempty"`
 	Environment map[string]string `yaml:"env,omitempty"`
 	Uses        string            `yaml:"uses,omitempty"`
+	With        map[string]string `yaml:"with,omitempty"`
 	Run         string            `yaml:"run,omitempty"`
 }
 
-func LoadActionsConfigIfPresent(path string) (*ActionsConfig, []byte, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return nil, nil, nil
-	} else if err != nil {
-		return nil, nil, fmt.Errorf("error checking Actions config path: %w", err)
+// ActionsEmitter writes GitHub Actions workflows, publishing images to GHCR.
+type ActionsEmitter struct{}
+
+func (ActionsEmitter) Path() string {
+	return GitHubActionsCiFilePath
+}
+
+func (ActionsEmitter) ExistingImages(existing []byte) (map[string]string, error) {
+	return actionsExistingImages(existing)
+}
+
+func (ActionsEmitter) Emit(pipeline Pipeline, existing []byte) ([]byte, error) {
+	return emitActions(pipeline, existing, actionsFlavour{
+		platformLoginCommand:   `buildah login "%s" -u "${{ github.actor }}" -p "${{ github.token }}"`,
+		uploadArtifactAction:   defaultGitHubUploadArtifactAction,
+		downloadArtifactAction: defaultGitHubDownloadArtifactAction,
+		includePermissions:     true,
+	})
+}
+
+// ForgejoEmitter writes Forgejo Actions workflows.
+type ForgejoEmitter struct{}
+
+func (ForgejoEmitter) Path() string {
+	return ForgejoActionsCiFilePath
+}
+
+func (ForgejoEmitter) ExistingImages(existing []byte) (map[string]string, error) {
+	return actionsExistingImages(existing)
+}
+
+func (ForgejoEmitter) Emit(pipeline Pipeline, existing []byte) ([]byte, error) {
+	return emitActions(pipeline, existing, actionsFlavour{
+		platformLoginCommand:   `buildah login "%s" -u ci -p "${{ secrets.PACKAGE_PUBLISH_TOKEN }}"`,
+		uploadArtifactAction:   defaultForgejoUploadArtifactAction,
+		downloadArtifactAction: defaultForgejoDownloadArtifactAction,
+	})
+}
+
+// actionsFlavour holds the differences between the GitHub and Forgejo dialects.
+type actionsFlavour struct {
+	// logs in to a registry (the %s) without configured credentials
+	platformLoginCommand string
+
+	// the default versions of the upload and download actions, used unless the existing file pins them
+	uploadArtifactAction   string
+	downloadArtifactAction string
+
+	// Forgejo ignores job permissions, so they are only written for GitHub
+	includePermissions bool
+}
+
+// actionsChangesJob detects which path-filtered jobs a run affects, exposing "true" or "false" as an output named after each job
+const (
+	actionsChangesJob            = "ci-changes"
+	actionsChangesTimeoutMinutes = 5
+)
+
+// actionsChangesScript compares the run's commit with the PR base or the previous push. Runs without either (tags, schedules, manual runs and new branches) affect every job.
+func actionsChangesScript(jobs []Job) string {
+	lines := []string{
+		`base="${{ github.event.pull_request.base.sha || github.event.before }}"`,
+		`all=false`,
+		`if [ "${{ github.ref_type }}" = "tag" ] || [ -z "$base" ] || [ "$base" = "0000000000000000000000000000000000000000" ]; then`,
+		`  all=true`,
+		`elif ! changed=$(git diff --name-only "$base" HEAD); then`,
+		`  all=true`,
+		`fi`,
+		`filter() {`,
+		`  if [ "$all" = "true" ] || echo "$changed" | grep -qE "$2"; then`,
+		`    echo "$1=true" >> "$GITHUB_OUTPUT"`,
+		`  else`,
+		`    echo "$1=false" >> "$GITHUB_OUTPUT"`,
+		`  fi`,
+		`}`,
 	}
 
-	contents, err := os.ReadFile(path)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error reading Actions config: %w", err)
+	for _, job := range jobs {
+		patterns := make([]string, len(job.Paths))
+		for i, p := range job.Paths {
+			patterns[i] = globPattern(p)
+		}
+		lines = append(lines, fmt.Sprintf(`filter "%s" '^(%s)$'`, job.Name, strings.Join(patterns, "|")))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// actionsAggregateScript checks the result of each needed job by name: only success passes, except for jobs that are allowed to be skipped.
+func actionsAggregateScript(needs []string, allowSkip map[string]bool) string {
+	lines := []string{
+		`failed=0`,
+		`check() {`,
+		`  if [ "$2" = "success" ] || { [ "$2" = "skipped" ] && [ "$3" = "allow-skip" ]; }; then`,
+		`    echo "$1: $2"`,
+		`  else`,
+		`    echo "$1: $2" >&2`,
+		`    failed=1`,
+		`  fi`,
+		`}`,
+	}
+
+	for _, name := range needs {
+		line := fmt.Sprintf(`check "%[1]s" "${{ needs['%[1]s'].result }}"`, name)
+		if allowSkip[name] {
+			line += " allow-skip"
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, `exit $failed`)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func emitActions(pipeline Pipeline, existing []byte, flavour actionsFlavour) ([]byte, error) {
+	// keep action versions from the existing file if possible
+	ciResourcesAction := actionsExistingUses(existing, defaultCIResourcesAction)
+	cacheAction := actionsExistingUses(existing, defaultCacheAction)
+	uploadArtifactAction := actionsExistingUses(existing, flavour.uploadArtifactAction)
+	downloadArtifactAction := actionsExistingUses(existing, flavour.downloadArtifactAction)
+
+	publishCondition := fmt.Sprintf("github.event_name == 'push' && (github.ref == 'refs/heads/%s' || startsWith(github.ref, 'refs/tags/'))", pipeline.DefaultBranch)
+
+	config := ActionsConfig{
+		Name: "CI",
+		On:   actionsTriggers(pipeline.Triggers),
+		Concurrency: &ActionsConcurrencyConfig{
+			// one run per ref; superseded runs are cancelled, except on the default branch and tags where every commit should publish
+			Group:            "${{ github.workflow }}-${{ github.ref }}",
+			CancelInProgress: fmt.Sprintf("${{ github.ref != 'refs/heads/%s' && !startsWith(github.ref, 'refs/tags/') }}", pipeline.DefaultBranch),
+		},
+		Jobs: map[string]ActionsJobConfig{},
+	}
+
+	allowSkip := map[string]bool{}
+	filteredJobs := []Job{}
+	for _, job := range pipeline.Jobs {
+		allowSkip[job.Name] = job.AllowSkip
+		if len(job.Paths) > 0 {
+			filteredJobs = append(filteredJobs, job)
+		}
+	}
+
+	if len(filteredJobs) > 0 {
+		changesJob := ActionsJobConfig{
+			RunsOn:         "ubuntu-latest",
+			TimeoutMinutes: actionsChangesTimeoutMinutes,
+			Outputs:        map[string]string{},
+			Steps: []ActionsJobStepConfig{
+				// full history, so that the base commit is available to diff against
+				{Uses: actionsExistingUses(existing, defaultCheckoutAction), With: map[string]string{"fetch-depth": "0"}},
+				{ID: "filter", Run: actionsChangesScript(filteredJobs)},
+			},
+		}
+
+		for _, job := range filteredJobs {
+			changesJob.Outputs[job.Name] = fmt.Sprintf("${{ steps.filter.outputs['%s'] }}", job.Name)
+		}
+
+		config.Jobs[actionsChangesJob] = changesJob
+	}
+
+	for _, job := range pipeline.Jobs {
+		actionsJob := ActionsJobConfig{
+			RunsOn:         "ubuntu-latest",
+			Needs:          job.Needs,
+			TimeoutMinutes: job.TimeoutMinutes,
+			Environment:    maps.Clone(job.Env),
+		}
+
+		// img and publish jobs run directly on the runner, which already has buildah
+		if job.Kind != JobImage && job.Kind != JobPublish {
+			actionsJob.Container.Image = job.Image
+		}
+
+		if flavour.includePermissions && len(job.Permissions) > 0 {
+			actionsJob.Permissions = maps.Clone(job.Permissions)
+		}
+
+		conditions := []string{}
+		if job.Kind == JobPublish {
+			conditions = append(conditions, publishCondition)
+		}
+		if len(job.Paths) > 0 {
+			actionsJob.Needs = append([]string{actionsChangesJob}, job.Needs...)
+			conditions = append(conditions, fmt.Sprintf("needs.%s.outputs['%s'] == 'true'", actionsChangesJob, job.Name))
+		}
+		actionsJob.If = strings.Join(conditions, " && ")
+
+		if job.Kind == JobAggregate {
+			if len(filteredJobs) > 0 {
+				actionsJob.Needs = append([]string{actionsChangesJob}, job.Needs...)
+			}
+			actionsJob.If = "always()"
+			actionsJob.Steps = append(actionsJob.Steps, ActionsJobStepConfig{Run: actionsAggregateScript(actionsJob.Needs, allowSkip)})
+		}
+
+		for _, step := range job.Steps {
+			actionsStep := ActionsJobStepConfig{}
+
+			switch step.Kind {
+			case StepInstallTools:
+				actionsStep.Uses = ciResourcesAction
+			case StepRegistryLogin:
+				if step.Registry.PasswordSecret == "" {
+					actionsStep.Run = fmt.Sprintf(flavour.platformLoginCommand, step.Registry.Host)
+				} else {
+					actionsStep.Run = step.Registry.loginCommand("$")
+				}
+			case StepNativeCache:
+				// expose the key and paths as step outputs, then let actions/cache restore now and save at the end of the job
+				actionsJob.Steps = append(actionsJob.Steps, ActionsJobStepConfig{
+					ID: "cache-meta",
+					Run: fmt.Sprintf(
+						`%s && echo "key=$(cat %s)" >> "$GITHUB_OUTPUT" && { echo "paths<<EOF"; tr ' ' '\n' < %s; echo "EOF"; } >> "$GITHUB_OUTPUT"`,
+						step.Run, step.Cache.KeyFile, step.Cache.PathsFile,
+					),
+				})
+				actionsStep.Uses = cacheAction
+				actionsStep.With = map[string]string{
+					"key":  "${{ steps.cache-meta.outputs.key }}",
+					"path": "${{ steps.cache-meta.outputs.paths }}",
+				}
+			case StepUploadArtifact:
+				actionsStep.Uses = uploadArtifactAction
+				actionsStep.With = map[string]string{
+					"name":              step.Artifact.Name,
+					"path":              strings.Join(step.Artifact.Paths, "\n"),
+					"if-no-files-found": "ignore",
+					// generated reports are written to .task-meta-* files, which would otherwise be skipped as hidden
+					"include-hidden-files": "true",
+				}
+				// images are only kept for the publish job in the same run
+				if step.Artifact.Kind == "image" {
+					actionsStep.With["if-no-files-found"] = "error"
+					actionsStep.With["retention-days"] = "1"
+				}
+			case StepDownloadArtifact:
+				// a single uploaded file is stored without its directories, so it is downloaded back into its own
+				actionsStep.Uses = downloadArtifactAction
+				actionsStep.With = map[string]string{
+					"name": step.Artifact.Name,
+					"path": path.Dir(step.Artifact.Paths[0]),
+				}
+			case StepSummary:
+				// Forgejo doesn't display summaries, so fall back to the log if there's nowhere to write one
+				actionsStep.Run = fmt.Sprintf("{\n%s} >> \"${GITHUB_STEP_SUMMARY:-/dev/stdout}\"\n", step.Run)
+			default:
+				actionsStep.Run = step.Run
+			}
+
+			if step.Always {
+				actionsStep.If = "always()"
+			} else if step.PublishOnly {
+				actionsStep.If = publishCondition
+			}
+
+			if len(step.Secrets) > 0 {
+				actionsStep.Environment = map[string]string{}
+				for envVar, secret := range step.Secrets {
+					actionsStep.Environment[envVar] = fmt.Sprintf("${{ secrets.%s }}", secret)
+				}
+			}
+
+			actionsJob.Steps = append(actionsJob.Steps, actionsStep)
+		}
+
+		config.Jobs[job.Name] = actionsJob
+	}
+
+	return encodeWithPinComments(config, existingPinComments(existing))
+}
+
+func actionsTriggers(triggers Triggers) ActionsTriggers {
+	output := ActionsTriggers{
+		Push: &ActionsPushTrigger{
+			Branches: triggers.PushBranches,
+			Tags:     triggers.PushTags,
+		},
 	}
 
+	if triggers.PullRequest {
+		output.PullRequest = &ActionsPullRequestTrigger{}
+	}
+
+	for _, cron := range triggers.Schedule {
+		output.Schedule = append(output.Schedule, ActionsScheduleTrigger{Cron: cron})
+	}
+
+	if triggers.WorkflowDispatch {
+		output.WorkflowDispatch = &ActionsWorkflowDispatchTrigger{}
+	}
+
+	return output
+}
+
+func parseActionsConfig(contents []byte) (*ActionsConfig, error) {
 	var config ActionsConfig
 	decoder := yaml.NewDecoder(bytes.NewReader(contents))
 	decoder.KnownFields(false)
-	err = decoder.Decode(&config)
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Actions config: %w", err)
+	}
+
+	return &config, nil
+}
+
+func actionsExistingImages(existing []byte) (map[string]string, error) {
+	if len(existing) == 0 {
+		return nil, nil
+	}
+
+	config, err := parseActionsConfig(existing)
 	if err != nil {
-		return nil, contents, fmt.Errorf("error parsing Actions config: %w", err)
+		return nil, err
+	}
+
+	images := map[string]string{}
+	for name, job := range config.Jobs {
+		if job.Container.Image != "" {
+			images[name] = job.Container.Image
+		}
+	}
+
+	return images, nil
+}
+
+// actionsExistingUses finds the version of an action used in an existing file, falling back to the given default reference.
+func actionsExistingUses(existing []byte, defaultRef string) string {
+	if len(existing) == 0 {
+		return defaultRef
+	}
+
+	config, err := parseActionsConfig(existing)
+	if err != nil {
+		// already reported via ExistingImages
+		return defaultRef
+	}
+
+	action, _, _ := strings.Cut(defaultRef, "@")
+	for _, job := range config.Jobs {
+		for _, step := range job.Steps {
+			if strings.HasPrefix(step.Uses, action+"@") {
+				return step.Uses
+			}
+		}
 	}
 
-	return &config, contents, nil
+	return defaultRef
 }
@@ -0,0 +1,85 @@
+package ci
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keys whose values are pinned by Renovate, which records the human-readable version in a trailing comment
+var pinnedKeys = []string{"image", "uses"}
+
+// existingPinComments maps each pinned value in an existing config file to the line comment after it.
+func existingPinComments(existing []byte) map[string]string {
+	comments := map[string]string{}
+	if len(existing) == 0 {
+		return comments
+	}
+
+	var root yaml.Node
+	err := yaml.Unmarshal(existing, &root)
+	if err != nil {
+		// unreadable files are already reported when their images are extracted
+		return comments
+	}
+
+	walkPinnedValues(&root, func(value *yaml.Node) {
+		if value.LineComment != "" {
+			comments[value.Value] = value.LineComment
+		}
+	})
+
+	return comments
+}
+
+// encodeWithPinComments encodes v as YAML, restoring the comments from existingPinComments on any pinned value that hasn't changed.
+func encodeWithPinComments(v any, comments map[string]string) ([]byte, error) {
+	encoded, err := encodeYAML(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// round-trip through a node tree rather than using Node.Encode, which can't represent the block scalars that the encoder itself writes
+	var root yaml.Node
+	err = yaml.Unmarshal(encoded, &root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding CI config: %w", err)
+	}
+
+	walkPinnedValues(&root, func(value *yaml.Node) {
+		if comment, ok := comments[value.Value]; ok {
+			value.LineComment = comment
+		}
+	})
+
+	return encodeYAML(&root)
+}
+
+func encodeYAML(v any) ([]byte, error) {
+	var outputBuffer bytes.Buffer
+	encoder := yaml.NewEncoder(&outputBuffer)
+	encoder.SetIndent(2)
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding CI config: %w", err)
+	}
+
+	return outputBuffer.Bytes(), nil
+}
+
+func walkPinnedValues(node *yaml.Node, fn func(value *yaml.Node)) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && slices.Contains(pinnedKeys, key.Value) {
+				fn(value)
+			}
+		}
+	}
+
+	for _, child := range node.Content {
+		walkPinnedValues(child, fn)
+	}
+}
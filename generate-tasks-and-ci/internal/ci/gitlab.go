@@ -0,0 +1,231 @@
+package ci
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const GitLabCiFilePath = ".gitlab-ci.yml"
+
+type GitLabConfig struct {
+	Workflow *GitLabWorkflowConfig      `yaml:"workflow,omitempty"`
+	Stages   []string                   `yaml:"stages"`
+	Jobs     map[string]GitLabJobConfig `yaml:",inline"`
+}
+
+type GitLabWorkflowConfig struct {
+	Rules []GitLabRuleConfig `yaml:"rules"`
+}
+
+type GitLabRuleConfig struct {
+	If      string   `yaml:"if,omitempty"`
+	Changes []string `yaml:"changes,omitempty"`
+}
+
+type GitLabJobConfig struct {
+	Stage         string             `yaml:"stage"`
+	Image         string             `yaml:"image"`
+	Needs         []string           `yaml:"needs,omitempty"`
+	Timeout       string             `yaml:"timeout,omitempty"`
+	Interruptible bool               `yaml:"interruptible,omitempty"`
+	Rules         []GitLabRuleConfig `yaml:"rules,omitempty"`
+	Variables     map[string]string  `yaml:"variables,omitempty"`
+	BeforeScript  []string           `yaml:"before_script,omitempty"`
+	Script        []string           `yaml:"script"`
+	AfterScript   []string           `yaml:"after_script,omitempty"`
+	Artifacts     *GitLabArtifacts   `yaml:"artifacts,omitempty"`
+}
+
+type GitLabArtifacts struct {
+	Name    string                  `yaml:"name,omitempty"`
+	When    string                  `yaml:"when,omitempty"`
+	Paths   []string                `yaml:"paths,omitempty"`
+	Reports *GitLabArtifactsReports `yaml:"reports,omitempty"`
+}
+
+type GitLabArtifactsReports struct {
+	JUnit []string `yaml:"junit,omitempty"`
+}
+
+// GitLabEmitter writes GitLab CI pipelines. The project's own registry is logged in to with the job's registry credentials if none are configured;
+// other registries must have configured credentials.
+type GitLabEmitter struct{}
+
+func (GitLabEmitter) Path() string {
+	return GitLabCiFilePath
+}
+
+func (GitLabEmitter) ExistingImages(existing []byte) (map[string]string, error) {
+	if len(existing) == 0 {
+		return nil, nil
+	}
+
+	var config GitLabConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(existing))
+	decoder.KnownFields(false)
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing GitLab config: %w", err)
+	}
+
+	images := map[string]string{}
+	for name, job := range config.Jobs {
+		if job.Image != "" {
+			images[name] = job.Image
+		}
+	}
+
+	return images, nil
+}
+
+func (GitLabEmitter) Emit(pipeline Pipeline, existing []byte) ([]byte, error) {
+	publishRule := fmt.Sprintf(`$CI_COMMIT_BRANCH == "%s" || $CI_COMMIT_TAG`, pipeline.DefaultBranch)
+
+	config := GitLabConfig{
+		Workflow: &GitLabWorkflowConfig{
+			Rules: gitlabWorkflowRules(pipeline.Triggers),
+		},
+		Stages: []string{string(JobCheck), string(JobImage), string(JobPublish)},
+		Jobs:   map[string]GitLabJobConfig{},
+	}
+
+	for _, job := range pipeline.Jobs {
+		// GitLab requires the whole pipeline to pass by itself, so there's nothing for an aggregate job to do
+		if job.Kind == JobAggregate {
+			continue
+		}
+
+		gitlabJob := GitLabJobConfig{
+			Stage:         string(job.Kind),
+			Image:         job.Image,
+			Needs:         job.Needs,
+			Interruptible: job.Cancellable,
+			Variables:     maps.Clone(job.Env),
+		}
+
+		if job.TimeoutMinutes > 0 {
+			gitlabJob.Timeout = fmt.Sprintf("%dm", job.TimeoutMinutes)
+		}
+
+		// a single rule, so that its conditions must all match
+		rule := GitLabRuleConfig{}
+		if job.Kind == JobPublish {
+			rule.If = publishRule
+		}
+
+		// GitLab treats changes rules as matching on pipelines it can't diff (tags, schedules and new branches), so those still run everything
+		for _, p := range job.Paths {
+			// GitLab's globs only match files, so a trailing "**" needs a file pattern after it
+			if strings.HasSuffix(p, "**") {
+				p += "/*"
+			}
+			rule.Changes = append(rule.Changes, p)
+		}
+
+		if rule.If != "" || len(rule.Changes) > 0 {
+			gitlabJob.Rules = []GitLabRuleConfig{rule}
+		}
+
+		// secrets are CI/CD variables in GitLab, so they are already in the environment
+		for _, step := range job.Steps {
+			command := step.Run
+			switch step.Kind {
+			case StepInstallTools:
+				command = installTaskCommand
+			case StepNativeCache:
+				return nil, fmt.Errorf("native caching is not supported on GitLab; choose another cache backend")
+			case StepRegistryLogin:
+				if step.Registry.PasswordSecret == "" {
+					// the job's credentials are only for the project's own registry, so they mustn't be sent anywhere else
+					host, _, _ := strings.Cut(step.Registry.Host, "/")
+					command = fmt.Sprintf(
+						`if [ "%[1]s" != "${CI_REGISTRY:-}" ]; then echo "%[1]s is not this project's GitLab registry; configure credentials for it in ci.registries" >&2; exit 1; fi; buildah login -u "${CI_REGISTRY_USER}" -p "${CI_REGISTRY_PASSWORD}" "%[2]s"`,
+						host, step.Registry.Host,
+					)
+				} else {
+					command = step.Registry.loginCommand("$")
+				}
+			case StepDownloadArtifact:
+				// jobs already download the artifacts of the jobs they need
+				continue
+			case StepUploadArtifact:
+				// GitLab keeps one artifact archive per job, so every artifact is merged into it
+				if gitlabJob.Artifacts == nil {
+					gitlabJob.Artifacts = &GitLabArtifacts{Name: job.Name, When: "always"}
+				}
+				if step.Artifact.Kind == "junit" {
+					if gitlabJob.Artifacts.Reports == nil {
+						gitlabJob.Artifacts.Reports = &GitLabArtifactsReports{}
+					}
+					gitlabJob.Artifacts.Reports.JUnit = append(gitlabJob.Artifacts.Reports.JUnit, step.Artifact.Paths...)
+				} else {
+					gitlabJob.Artifacts.Paths = append(gitlabJob.Artifacts.Paths, step.Artifact.Paths...)
+				}
+				continue
+			}
+
+			if step.PublishOnly {
+				command = fmt.Sprintf(`if [ "${CI_COMMIT_BRANCH:-}" = "%s" ] || [ -n "${CI_COMMIT_TAG:-}" ]; then %s; fi`, pipeline.DefaultBranch, command)
+			}
+
+			if step.Kind == StepInstallTools || step.Kind == StepSetup {
+				gitlabJob.BeforeScript = append(gitlabJob.BeforeScript, command)
+			} else if step.Always {
+				// after_script runs whether or not the script failed
+				gitlabJob.AfterScript = append(gitlabJob.AfterScript, command)
+			} else {
+				gitlabJob.Script = append(gitlabJob.Script, command)
+			}
+		}
+
+		config.Jobs[job.Name] = gitlabJob
+	}
+
+	return encodeWithPinComments(config, existingPinComments(existing))
+}
+
+// gitlabWorkflowRules translates the triggers into workflow rules. Schedules themselves live in the GitLab UI, so a schedule just allows scheduled pipelines to run.
+func gitlabWorkflowRules(triggers Triggers) []GitLabRuleConfig {
+	rules := []GitLabRuleConfig{}
+
+	if triggers.PullRequest {
+		rules = append(rules, GitLabRuleConfig{If: `$CI_PIPELINE_SOURCE == "merge_request_event"`})
+	}
+
+	for _, b := range triggers.PushBranches {
+		rules = append(rules, GitLabRuleConfig{If: gitlabRefRule("$CI_COMMIT_BRANCH", b)})
+	}
+
+	for _, t := range triggers.PushTags {
+		rules = append(rules, GitLabRuleConfig{If: gitlabRefRule("$CI_COMMIT_TAG", t)})
+	}
+
+	if len(triggers.Schedule) > 0 {
+		rules = append(rules, GitLabRuleConfig{If: `$CI_PIPELINE_SOURCE == "schedule"`})
+	}
+
+	if triggers.WorkflowDispatch {
+		rules = append(rules, GitLabRuleConfig{If: `$CI_PIPELINE_SOURCE == "web"`})
+	}
+
+	return rules
+}
+
+// gitlabRefRule converts an Actions-style ref filter into a rule expression: "*" matches within a path segment and "**" matches anything.
+func gitlabRefRule(variable string, filter string) string {
+	if filter == "**" {
+		return variable
+	}
+
+	if !strings.Contains(filter, "*") {
+		return fmt.Sprintf(`%s == "%s"`, variable, filter)
+	}
+
+	pattern := strings.ReplaceAll(globPattern(filter), `/`, `\/`)
+
+	return fmt.Sprintf(`%s =~ /^%s$/`, variable, pattern)
+}
@@ -0,0 +1,178 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pipeline is a platform-neutral description of the CI jobs for a project. Emitters translate it into a specific CI system's config.
+type Pipeline struct {
+	// DefaultBranch is the branch that runs publish jobs, alongside tags.
+	DefaultBranch string
+	Triggers      Triggers
+
+	// Jobs are ordered by name.
+	Jobs []Job
+}
+
+// Triggers are the events that run the pipeline, with defaults already applied.
+type Triggers struct {
+	PushBranches     []string
+	PushTags         []string
+	PullRequest      bool
+	Schedule         []string
+	WorkflowDispatch bool
+}
+
+type JobKind string
+
+const (
+	// JobCheck jobs lint and test a single project/language pair in the language's image.
+	JobCheck JobKind = "check"
+
+	// JobImage jobs check that a project's container image builds, without pushing it.
+	JobImage JobKind = "img"
+
+	// JobPublish jobs build and push a project's container image. They only run for pushes to the default branch or tags.
+	JobPublish JobKind = "publish"
+
+	// JobAggregate jobs pass only if every job they need passed. Platforms that can require the whole pipeline to pass may leave them out.
+	JobAggregate JobKind = "all"
+)
+
+type Job struct {
+	Name  string
+	Kind  JobKind
+	Image string
+
+	// Needs are the names of jobs that must finish first.
+	Needs []string
+
+	TimeoutMinutes int
+
+	// Cancellable jobs may be stopped when a newer run for the same ref starts.
+	Cancellable bool
+
+	// AllowSkip jobs are expected to be skipped on some runs, so a skip doesn't fail the aggregate job.
+	AllowSkip bool
+
+	// Paths restricts the job to runs that change a file matching one of these globs, relative to the repo root. Empty means every run.
+	Paths []string
+
+	Env         map[string]string
+	Permissions map[string]string
+	Steps       []Step
+}
+
+type StepKind string
+
+const (
+	// StepInstallTools makes Task and the other CI tools available.
+	StepInstallTools StepKind = "install-tools"
+
+	// StepSetup prepares the job environment, before any tasks run.
+	StepSetup StepKind = "setup"
+
+	// StepRun runs a task.
+	StepRun StepKind = "run"
+
+	// StepRegistryLogin logs in to the container registry described by Registry.
+	StepRegistryLogin StepKind = "registry-login"
+
+	// StepNativeCache runs Run to write the cache key and paths files, then restores and saves the cache with the platform's own caching.
+	StepNativeCache StepKind = "native-cache"
+
+	// StepUploadArtifact keeps the files described by Artifact once the job has finished.
+	StepUploadArtifact StepKind = "upload-artifact"
+
+	// StepDownloadArtifact fetches the files described by Artifact, which were uploaded by a job that this one needs.
+	StepDownloadArtifact StepKind = "download-artifact"
+
+	// StepSummary runs Run, which prints a Markdown summary of the job for platforms that can display one.
+	StepSummary StepKind = "summary"
+)
+
+type Step struct {
+	Kind StepKind
+	Run  string
+
+	// Secrets maps environment variable names to the names of the secrets that populate them.
+	Secrets map[string]string
+
+	// Always steps run even if an earlier step in the job failed.
+	Always bool
+
+	// PublishOnly steps only run on the refs that publish jobs run on: pushes to the default branch and tags.
+	PublishOnly bool
+
+	Cache    *StepCache
+	Artifact *StepArtifact
+	Registry *StepRegistry
+}
+
+// StepRegistry is a container registry to log in to. Registries without a PasswordSecret use the platform's own credentials.
+type StepRegistry struct {
+	Host string
+
+	// Username is used as-is, or read from the UsernameSecret environment variable.
+	Username       string
+	UsernameSecret string
+
+	// PasswordSecret is the environment variable holding the password, populated from the step's Secrets.
+	PasswordSecret string
+}
+
+// loginCommand logs in to a registry with configured credentials. Variables are written with the given prefix so that emitters can escape them.
+func (r StepRegistry) loginCommand(variablePrefix string) string {
+	username := r.Username
+	if username == "" {
+		username = fmt.Sprintf("%s{%s}", variablePrefix, r.UsernameSecret)
+	}
+
+	return fmt.Sprintf(`buildah login "%s" -u "%s" -p "%s{%s}"`, r.Host, username, variablePrefix, r.PasswordSecret)
+}
+
+// StepCache locates the files describing a native cache, relative to the project root.
+type StepCache struct {
+	// KeyFile holds the cache key.
+	KeyFile string
+
+	// PathsFile holds a space-separated list of paths to cache.
+	PathsFile string
+}
+
+// StepArtifact is a named set of files to upload, with paths relative to the project root.
+type StepArtifact struct {
+	// Name is unique within the pipeline.
+	Name string
+
+	// Kind is one of the task.ArtifactKind values, which some platforms use to display the artifact (e.g. JUnit reports).
+	Kind  string
+	Paths []string
+}
+
+// Emitter writes a pipeline as the config file for one CI system.
+type Emitter interface {
+	// Path is the config file location, relative to the project root.
+	Path() string
+
+	// ExistingImages maps job names to the container images they use in an existing config file, so that versions pinned by Renovate survive regeneration.
+	ExistingImages(existing []byte) (map[string]string, error)
+
+	// Emit renders the pipeline, without the generated file header. The existing file, if any, is passed in so that other pinned resources and their version comments can be kept.
+	Emit(pipeline Pipeline, existing []byte) ([]byte, error)
+}
+
+// the Actions jobs get Task from the ci-resources action; other platforms have no equivalent, so it is installed by each job
+const installTaskCommand = `sh -c "$(curl --location --silent --show-error https://taskfile.dev/install.sh)" -- -d -b .`
+
+// globPattern converts a path glob into an unanchored regular expression: "**" matches anything, "*" and "?" match within a path segment.
+func globPattern(glob string) string {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*\*`, `.*`)
+	pattern = strings.ReplaceAll(pattern, `\*`, `[^/]*`)
+	pattern = strings.ReplaceAll(pattern, `\?`, `[^/]`)
+
+	return pattern
+}
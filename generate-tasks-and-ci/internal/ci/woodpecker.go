@@ -0,0 +1,182 @@
+package ci
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const WoodpeckerCiFilePath = ".woodpecker/ci.yml"
+
+type WoodpeckerConfig struct {
+	When  []WoodpeckerWhenConfig `yaml:"when,omitempty"`
+	Steps []WoodpeckerStepConfig `yaml:"steps"`
+}
+
+type WoodpeckerWhenConfig struct {
+	Event  string                `yaml:"event,omitempty"`
+	Branch string                `yaml:"branch,omitempty"`
+	Ref    string                `yaml:"ref,omitempty"`
+	Path   *WoodpeckerPathConfig `yaml:"path,omitempty"`
+}
+
+type WoodpeckerStepConfig struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+	// always written, because an empty list is what tells Woodpecker to start a step immediately
+	DependsOn []string `yaml:"depends_on"`
+	// values are either plain strings or {from_secret: name} mappings
+	Environment map[string]any `yaml:"environment,omitempty"`
+	Commands    []string       `yaml:"commands"`
+	// a step runs if any of these conditions match
+	When []WoodpeckerWhenConfig `yaml:"when,omitempty"`
+}
+
+type WoodpeckerPathConfig struct {
+	Include []string `yaml:"include"`
+}
+
+// WoodpeckerEmitter writes Woodpecker pipelines. Registries without configured credentials are logged in to with the package_publish_token secret.
+type WoodpeckerEmitter struct{}
+
+func (WoodpeckerEmitter) Path() string {
+	return WoodpeckerCiFilePath
+}
+
+func (WoodpeckerEmitter) ExistingImages(existing []byte) (map[string]string, error) {
+	if len(existing) == 0 {
+		return nil, nil
+	}
+
+	var config WoodpeckerConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(existing))
+	decoder.KnownFields(false)
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Woodpecker config: %w", err)
+	}
+
+	images := map[string]string{}
+	for _, step := range config.Steps {
+		if step.Image != "" {
+			images[step.Name] = step.Image
+		}
+	}
+
+	return images, nil
+}
+
+// note: Woodpecker substitutes ${VAR} in the pipeline itself, so variables meant for the shell are escaped as $${VAR}
+
+func (WoodpeckerEmitter) Emit(pipeline Pipeline, existing []byte) ([]byte, error) {
+	config := WoodpeckerConfig{
+		When: woodpeckerWhen(pipeline.Triggers),
+	}
+
+	for _, job := range pipeline.Jobs {
+		// Woodpecker requires the whole pipeline to pass by itself, so there's nothing for an aggregate job to do
+		if job.Kind == JobAggregate {
+			continue
+		}
+
+		step := WoodpeckerStepConfig{
+			Name:        job.Name,
+			Image:       job.Image,
+			DependsOn:   job.Needs,
+			Environment: map[string]any{},
+		}
+
+		if step.DependsOn == nil {
+			step.DependsOn = []string{}
+		}
+
+		// path conditions only apply to push and pull request events, so tags, cron and manual runs still run everything
+		var paths *WoodpeckerPathConfig
+		if len(job.Paths) > 0 {
+			paths = &WoodpeckerPathConfig{Include: job.Paths}
+		}
+
+		if job.Kind == JobPublish {
+			step.When = []WoodpeckerWhenConfig{
+				{Event: "push", Branch: pipeline.DefaultBranch, Path: paths},
+				{Event: "tag"},
+			}
+		} else if paths != nil {
+			step.When = []WoodpeckerWhenConfig{{Path: paths}}
+		}
+
+		// jobs are a single step, so every command shares the step's environment
+		for k, v := range job.Env {
+			step.Environment[k] = v
+		}
+
+		for _, s := range job.Steps {
+			// Woodpecker has no artifact storage, and a step's commands stop at the first failure, so there's nowhere useful for these to go;
+			// files that later steps need are already in the shared workspace
+			if s.Kind == StepUploadArtifact || s.Kind == StepDownloadArtifact || s.Kind == StepSummary {
+				continue
+			}
+
+			command := s.Run
+			switch s.Kind {
+			case StepInstallTools:
+				command = installTaskCommand
+			case StepNativeCache:
+				return nil, fmt.Errorf("native caching is not supported on Woodpecker; choose another cache backend")
+			case StepRegistryLogin:
+				if s.Registry.PasswordSecret == "" {
+					command = fmt.Sprintf(`buildah login "%s" -u ci -p "$${PACKAGE_PUBLISH_TOKEN}"`, s.Registry.Host)
+					step.Environment["PACKAGE_PUBLISH_TOKEN"] = map[string]string{"from_secret": "package_publish_token"}
+				} else {
+					command = s.Registry.loginCommand("$$")
+				}
+			}
+
+			if s.PublishOnly {
+				command = fmt.Sprintf(
+					`if [ "$${CI_PIPELINE_EVENT}" = "tag" ] || { [ "$${CI_PIPELINE_EVENT}" = "push" ] && [ "$${CI_COMMIT_BRANCH}" = "%s" ]; }; then %s; fi`,
+					pipeline.DefaultBranch, command,
+				)
+			}
+
+			for envVar, secret := range s.Secrets {
+				step.Environment[envVar] = map[string]string{"from_secret": strings.ToLower(secret)}
+			}
+
+			step.Commands = append(step.Commands, command)
+		}
+
+		config.Steps = append(config.Steps, step)
+	}
+
+	return encodeWithPinComments(config, existingPinComments(existing))
+}
+
+// woodpeckerWhen translates the triggers into pipeline-level filters. Cron jobs themselves are created in the Woodpecker UI.
+func woodpeckerWhen(triggers Triggers) []WoodpeckerWhenConfig {
+	when := []WoodpeckerWhenConfig{}
+
+	for _, b := range triggers.PushBranches {
+		when = append(when, WoodpeckerWhenConfig{Event: "push", Branch: b})
+	}
+
+	for _, t := range triggers.PushTags {
+		when = append(when, WoodpeckerWhenConfig{Event: "tag", Ref: "refs/tags/" + t})
+	}
+
+	if triggers.PullRequest {
+		when = append(when, WoodpeckerWhenConfig{Event: "pull_request"})
+	}
+
+	if len(triggers.Schedule) > 0 {
+		when = append(when, WoodpeckerWhenConfig{Event: "cron"})
+	}
+
+	if triggers.WorkflowDispatch {
+		when = append(when, WoodpeckerWhenConfig{Event: "manual"})
+	}
+
+	return when
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the repo-level config file, read from the root of the project.
+const FileName = ".tedium-tasks.yml"
+
+type Config struct {
+	Ignore    []string                  `yaml:"ignore,omitempty"`
+	Projects  []ProjectConfig           `yaml:"projects,omitempty"`
+	Languages map[string]LanguageConfig `yaml:"languages,omitempty"`
+	Images    ImagesConfig              `yaml:"images,omitempty"`
+	CI        CIConfig                  `yaml:"ci,omitempty"`
+}
+
+// ImagesConfig customises how container images are tagged.
+type ImagesConfig struct {
+	// Tags lists the tag strategies to use: "version", "major", "minor", "latest", "sha", "branch" or "date". Empty means version, major and latest.
+	Tags []string `yaml:"tags,omitempty"`
+
+	Scan ScanConfig `yaml:"scan,omitempty"`
+}
+
+// ScanConfig enables vulnerability scanning of built images, which blocks pushing if it fails.
+type ScanConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Scanner is "trivy" (the default) or "grype".
+	Scanner string `yaml:"scanner,omitempty"`
+
+	// Severity is the lowest severity that fails the scan: "low", "medium", "high" (the default) or "critical".
+	Severity string `yaml:"severity,omitempty"`
+
+	// IgnoreFile is relative to each image project: a .trivyignore file for Trivy, or a config file with ignore rules for Grype.
+	IgnoreFile string `yaml:"ignoreFile,omitempty"`
+
+	// DBDir is a pre-populated vulnerability database to scan with offline, instead of downloading and caching one.
+	DBDir string `yaml:"dbDir,omitempty"`
+}
+
+// ProjectConfig customises the tasks generated for the project(s) at Path, optionally restricted to a single language.
+type ProjectConfig struct {
+	Path     string            `yaml:"path"`
+	Language string            `yaml:"language,omitempty"`
+	Skip     bool              `yaml:"skip,omitempty"`
+	Disable  []string          `yaml:"disable,omitempty"`
+	Commands map[string]string `yaml:"commands,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+
+	// Artifacts are extra outputs to upload from the project's check jobs, such as built binaries or lint reports.
+	Artifacts []ArtifactConfig `yaml:"artifacts,omitempty"`
+}
+
+// ArtifactConfig declares files to upload from CI, with paths relative to the project.
+type ArtifactConfig struct {
+	Name string `yaml:"name"`
+	// Kind is one of "junit", "coverage", "binary" or "sarif", or empty for anything else.
+	Kind  string   `yaml:"kind,omitempty"`
+	Paths []string `yaml:"paths"`
+}
+
+var artifactKinds = []string{"", "junit", "coverage", "binary", "sarif"}
+
+// LanguageConfig customises the lint and test steps for every project of a language.
+type LanguageConfig struct {
+	RuntimePackages []string          `yaml:"runtimePackages,omitempty"`
+	RuntimeEnv      map[string]string `yaml:"runtimeEnv,omitempty"`
+}
+
+type CIConfig struct {
+	// Platform forces the CI output format: "actions" (GitHub or Forgejo), "gitlab" or "woodpecker". Empty means detect it.
+	Platform string `yaml:"platform,omitempty"`
+
+	Triggers TriggersConfig `yaml:"triggers,omitempty"`
+
+	// Timeouts overrides the default timeout in minutes for each job type ("check", "img" or "all").
+	Timeouts map[string]int `yaml:"timeouts,omitempty"`
+
+	Cache CacheConfig `yaml:"cache,omitempty"`
+
+	PathFilters PathFiltersConfig `yaml:"pathFilters,omitempty"`
+
+	// Registries sets the credentials for pushing to each registry, keyed by host. Registries without credentials use the CI platform's own.
+	Registries map[string]RegistryConfig `yaml:"registries,omitempty"`
+}
+
+// RegistryConfig names the CI secrets holding a registry's credentials.
+type RegistryConfig struct {
+	// Username is used as-is, or UsernameSecret names a secret to read it from.
+	Username       string `yaml:"username,omitempty"`
+	UsernameSecret string `yaml:"usernameSecret,omitempty"`
+	PasswordSecret string `yaml:"passwordSecret"`
+}
+
+// PathFiltersConfig skips the jobs for projects that a run doesn't change.
+type PathFiltersConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Shared are extra globs, relative to the repo root, whose changes run every job.
+	Shared []string `yaml:"shared,omitempty"`
+}
+
+// CacheConfig selects where the cacheload and cachesave tasks keep dependency caches.
+type CacheConfig struct {
+	// Backend is one of "server" (the default), "s3", "local", "native" or "none".
+	Backend string `yaml:"backend,omitempty"`
+
+	// URL is the base URL of the cache server.
+	URL string `yaml:"url,omitempty"`
+
+	// Endpoint, Bucket and Region locate the S3-compatible bucket.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	Bucket   string `yaml:"bucket,omitempty"`
+	Region   string `yaml:"region,omitempty"`
+
+	// Dir is the directory on the runner for the local cache.
+	Dir string `yaml:"dir,omitempty"`
+}
+
+// TriggersConfig overrides the events that run CI. Unset fields keep their defaults.
+type TriggersConfig struct {
+	PushBranches     []string `yaml:"pushBranches,omitempty"`
+	PushTags         []string `yaml:"pushTags,omitempty"`
+	PullRequest      *bool    `yaml:"pullRequest,omitempty"`
+	Schedule         []string `yaml:"schedule,omitempty"`
+	WorkflowDispatch *bool    `yaml:"workflowDispatch,omitempty"`
+}
+
+// Load reads the config file from the project at projectPath. A missing file is not an error.
+func Load(projectPath string) (Config, error) {
+	contents, err := os.ReadFile(path.Join(projectPath, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil
+	} else if err != nil {
+		return Config{}, fmt.Errorf("error reading %s: %w", FileName, err)
+	}
+
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("error parsing %s: %w", FileName, err)
+	}
+
+	for i := range config.Projects {
+		if config.Projects[i].Path == "" {
+			return Config{}, fmt.Errorf("error parsing %s: project %d has no path", FileName, i)
+		}
+		config.Projects[i].Path = path.Clean(config.Projects[i].Path)
+
+		for _, a := range config.Projects[i].Artifacts {
+			if a.Name == "" || len(a.Paths) == 0 {
+				return Config{}, fmt.Errorf("error parsing %s: artifacts for %s need a name and at least one path", FileName, config.Projects[i].Path)
+			}
+			if !slices.Contains(artifactKinds, a.Kind) {
+				return Config{}, fmt.Errorf("error parsing %s: artifact %s has unknown kind '%s'", FileName, a.Name, a.Kind)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+var (
+	runtimePackagesVar = regexp.MustCompile(`^([A-Z0-9]+)_RUNTIME_PACKAGES$`)
+	runtimeEnvVar      = regexp.MustCompile(`^([A-Z0-9]+)_RUNTIME_ENV_(.+)$`)
+)
+
+// FromEnv builds config from environment variables (in os.Environ format):
+//
+//   - IGNORE_PATHS - comma-separated ignore patterns
+//   - ${LANGUAGE}_RUNTIME_PACKAGES - space or comma-separated packages for a language
+//   - ${LANGUAGE}_RUNTIME_ENV_${KEY} - extra environment variables for a language
+func FromEnv(environ []string) Config {
+	config := Config{}
+
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+
+		if key == "IGNORE_PATHS" {
+			config.Ignore = append(config.Ignore, splitList(value)...)
+			continue
+		}
+
+		if m := runtimePackagesVar.FindStringSubmatch(key); m != nil {
+			lang := config.language(m[1])
+			lang.RuntimePackages = append(lang.RuntimePackages, splitList(value)...)
+			config.Languages[strings.ToLower(m[1])] = lang
+			continue
+		}
+
+		if m := runtimeEnvVar.FindStringSubmatch(key); m != nil {
+			lang := config.language(m[1])
+			if lang.RuntimeEnv == nil {
+				lang.RuntimeEnv = map[string]string{}
+			}
+			lang.RuntimeEnv[m[2]] = value
+			config.Languages[strings.ToLower(m[1])] = lang
+			continue
+		}
+	}
+
+	return config
+}
+
+func (c *Config) language(name string) LanguageConfig {
+	if c.Languages == nil {
+		c.Languages = map[string]LanguageConfig{}
+	}
+
+	return c.Languages[strings.ToLower(name)]
+}
+
+// Merge returns a copy of c with other layered on top. Lists are appended and map entries in other take precedence.
+func (c Config) Merge(other Config) Config {
+	merged := Config{
+		Ignore:    append(append([]string{}, c.Ignore...), other.Ignore...),
+		Projects:  append(append([]ProjectConfig{}, c.Projects...), other.Projects...),
+		Languages: map[string]LanguageConfig{},
+	}
+
+	for _, source := range []map[string]LanguageConfig{c.Languages, other.Languages} {
+		for name, lang := range source {
+			existing := merged.Languages[name]
+			existing.RuntimePackages = append(append([]string{}, existing.RuntimePackages...), lang.RuntimePackages...)
+			if len(lang.RuntimeEnv) > 0 {
+				env := maps.Clone(existing.RuntimeEnv)
+				if env == nil {
+					env = map[string]string{}
+				}
+				maps.Copy(env, lang.RuntimeEnv)
+				existing.RuntimeEnv = env
+			}
+			merged.Languages[name] = existing
+		}
+	}
+
+	merged.Images = c.Images
+	if other.Images.Tags != nil {
+		merged.Images.Tags = other.Images.Tags
+	}
+	if other.Images.Scan != (ScanConfig{}) {
+		merged.Images.Scan = other.Images.Scan
+	}
+
+	merged.CI = c.CI
+	if other.CI.Platform != "" {
+		merged.CI.Platform = other.CI.Platform
+	}
+	if other.CI.Triggers.PushBranches != nil {
+		merged.CI.Triggers.PushBranches = other.CI.Triggers.PushBranches
+	}
+	if other.CI.Triggers.PushTags != nil {
+		merged.CI.Triggers.PushTags = other.CI.Triggers.PushTags
+	}
+	if other.CI.Triggers.PullRequest != nil {
+		merged.CI.Triggers.PullRequest = other.CI.Triggers.PullRequest
+	}
+	if other.CI.Triggers.Schedule != nil {
+		merged.CI.Triggers.Schedule = other.CI.Triggers.Schedule
+	}
+	if other.CI.Triggers.WorkflowDispatch != nil {
+		merged.CI.Triggers.WorkflowDispatch = other.CI.Triggers.WorkflowDispatch
+	}
+	if other.CI.PathFilters.Enabled {
+		merged.CI.PathFilters.Enabled = true
+	}
+	if len(other.CI.PathFilters.Shared) > 0 {
+		merged.CI.PathFilters.Shared = append(append([]string{}, c.CI.PathFilters.Shared...), other.CI.PathFilters.Shared...)
+	}
+	if other.CI.Cache != (CacheConfig{}) {
+		merged.CI.Cache = other.CI.Cache
+	}
+	if len(other.CI.Registries) > 0 {
+		merged.CI.Registries = maps.Clone(c.CI.Registries)
+		if merged.CI.Registries == nil {
+			merged.CI.Registries = map[string]RegistryConfig{}
+		}
+		maps.Copy(merged.CI.Registries, other.CI.Registries)
+	}
+	if len(other.CI.Timeouts) > 0 {
+		merged.CI.Timeouts = maps.Clone(c.CI.Timeouts)
+		if merged.CI.Timeouts == nil {
+			merged.CI.Timeouts = map[string]int{}
+		}
+		maps.Copy(merged.CI.Timeouts, other.CI.Timeouts)
+	}
+
+	return merged
+}
+
+// ProjectsAt returns the project config entries that apply to the given path and language, in the order they were declared.
+func (c Config) ProjectsAt(relativePath string, language string) []ProjectConfig {
+	relativePath = path.Clean(relativePath)
+
+	matches := []ProjectConfig{}
+	for _, p := range c.Projects {
+		if p.Path != relativePath {
+			continue
+		}
+
+		if p.Language != "" && p.Language != language {
+			continue
+		}
+
+		matches = append(matches, p)
+	}
+
+	return matches
+}
+
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
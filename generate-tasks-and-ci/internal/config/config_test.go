@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	actual := FromEnv([]string{
+		"HOME=/root",
+		"IGNORE_PATHS=examples, legacy/**",
+		"GO_RUNTIME_PACKAGES=libusb-1.0-0-dev pkg-config",
+		"GO_RUNTIME_ENV_GOFLAGS=-foo=bar",
+		"JS_RUNTIME_ENV_NODE_OPTIONS=--max-old-space-size=4096",
+	})
+
+	expected := Config{
+		Ignore: []string{"examples", "legacy/**"},
+		Languages: map[string]LanguageConfig{
+			"go": {
+				RuntimePackages: []string{"libusb-1.0-0-dev", "pkg-config"},
+				RuntimeEnv:      map[string]string{"GOFLAGS": "-foo=bar"},
+			},
+			"js": {
+				RuntimeEnv: map[string]string{"NODE_OPTIONS": "--max-old-space-size=4096"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := Config{
+		Ignore:   []string{"a"},
+		Projects: []ProjectConfig{{Path: "api", Skip: true}},
+		Languages: map[string]LanguageConfig{
+			"go": {RuntimePackages: []string{"gcc"}, RuntimeEnv: map[string]string{"A": "1", "B": "1"}},
+		},
+	}
+
+	override := Config{
+		Ignore: []string{"b"},
+		Languages: map[string]LanguageConfig{
+			"go": {RuntimePackages: []string{"make"}, RuntimeEnv: map[string]string{"B": "2"}},
+		},
+	}
+
+	actual := base.Merge(override)
+	expected := Config{
+		Ignore:   []string{"a", "b"},
+		Projects: []ProjectConfig{{Path: "api", Skip: true}},
+		Languages: map[string]LanguageConfig{
+			"go": {RuntimePackages: []string{"gcc", "make"}, RuntimeEnv: map[string]string{"A": "1", "B": "2"}},
+		},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	// trigger overrides replace the base value only when set
+	disabled := false
+	triggersBase := Config{CI: CIConfig{Triggers: TriggersConfig{PushTags: []string{"v*"}, Schedule: []string{"0 4 * * *"}}}}
+	triggersOverride := Config{CI: CIConfig{Triggers: TriggersConfig{Schedule: []string{}, PullRequest: &disabled}}}
+	triggers := triggersBase.Merge(triggersOverride).CI.Triggers
+	if !reflect.DeepEqual(triggers.PushTags, []string{"v*"}) || len(triggers.Schedule) != 0 || triggers.PullRequest == nil || *triggers.PullRequest {
+		t.Errorf("unexpected merged triggers: %+v", triggers)
+	}
+
+	timeoutsBase := Config{CI: CIConfig{Timeouts: map[string]int{"check": 10, "img": 20}}}
+	timeoutsOverride := Config{CI: CIConfig{Timeouts: map[string]int{"img": 40}}}
+	timeouts := timeoutsBase.Merge(timeoutsOverride).CI.Timeouts
+	if !reflect.DeepEqual(timeouts, map[string]int{"check": 10, "img": 40}) {
+		t.Errorf("unexpected merged timeouts: %+v", timeouts)
+	}
+
+	// merging must not mutate the inputs
+	if base.Languages["go"].RuntimeEnv["B"] != "1" {
+		t.Error("merge mutated the base config")
+	}
+}
@@ -0,0 +1,46 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/lanuages"
+)
+
+const defaultCacheServerURL = "https://ci-cache.markormesher.co.uk"
+
+func cacheBackend(cfg config.CacheConfig) (lanuages.CacheBackend, error) {
+	switch cfg.Backend {
+	case "", "server":
+		url := cfg.URL
+		if url == "" {
+			url = defaultCacheServerURL
+		}
+		return lanuages.ServerCache{URL: url}, nil
+
+	case "s3":
+		if cfg.Endpoint == "" || cfg.Bucket == "" {
+			return nil, fmt.Errorf("the s3 cache backend requires an endpoint and a bucket")
+		}
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return lanuages.S3Cache{Endpoint: cfg.Endpoint, Bucket: cfg.Bucket, Region: region}, nil
+
+	case "local":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("the local cache backend requires a dir")
+		}
+		return lanuages.LocalCache{Dir: cfg.Dir}, nil
+
+	case "native":
+		return lanuages.NativeCache{}, nil
+
+	case "none":
+		return lanuages.NoCache{}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported cache backend '%s'", cfg.Backend)
+	}
+}
@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/ci"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/lanuages"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+)
+
+// ResourceSet is a utility type to store the container image references used for various steps.
+type ResourceSet struct {
+	bufStepImage  string
+	goStepImage   string
+	imgStepImage  string
+	jsStepImage   string
+	sqlcStepImage string
+	utilStepImage string
+}
+
+func generateCIConfig(projectPath string, taskfile *task.TaskFile, opts Options, cfg config.Config, settings lanuages.Settings) (File, error) {
+	emitter, err := ciEmitter(opts, cfg)
+	if err != nil {
+		return File{}, err
+	}
+
+	// extract resource versions from existing CI files if possible
+	existing, err := os.ReadFile(path.Join(projectPath, emitter.Path()))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("error reading existing config - continuing without it", "error", err)
+	}
+
+	resourceSet := ResourceSet{}
+	images, err := emitter.ExistingImages(existing)
+	if err != nil {
+		slog.Warn("error reading existing config - continuing without it", "error", err)
+	}
+	for jobName, image := range images {
+		resourceSet.recordImage(jobName, image)
+	}
+	resourceSet.populateMissingResources()
+
+	pipeline, err := buildPipeline(taskfile, opts, cfg, settings, resourceSet)
+	if err != nil {
+		return File{}, err
+	}
+
+	output, err := emitter.Emit(pipeline, existing)
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{
+		Path:     emitter.Path(),
+		Contents: append([]byte(generatedFileHeader+"\n"), output...),
+	}, nil
+}
+
+// ciEmitter picks the CI system to write config for, preferring an explicit choice in config over the platform reported by Tedium.
+func ciEmitter(opts Options, cfg config.Config) (ci.Emitter, error) {
+	platform := cfg.CI.Platform
+	if platform == "" {
+		if opts.PlatformType == "gitlab" {
+			platform = "gitlab"
+		} else {
+			platform = "actions"
+		}
+	}
+
+	switch platform {
+	case "actions":
+		if opts.PrivateGitDomain == "" {
+			return ci.ActionsEmitter{}, nil
+		}
+		return ci.ForgejoEmitter{}, nil
+	case "gitlab":
+		return ci.GitLabEmitter{}, nil
+	case "woodpecker":
+		return ci.WoodpeckerEmitter{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported CI platform '%s'", platform)
+	}
+}
+
+func runtimePackagesCommand(packages []string) string {
+	quoted := make([]string, len(packages))
+	for i, p := range packages {
+		quoted[i] = strconv.Quote(p)
+	}
+
+	return fmt.Sprintf("apt-get update && apt-get install -y --no-install-recommends %s", strings.Join(quoted, " "))
+}
+
+func getImageForLanguageTask(imageSet ResourceSet, lang string) (string, error) {
+	switch lang {
+	case "buf":
+		return imageSet.bufStepImage, nil
+	case "go":
+		return imageSet.goStepImage, nil
+	case "js":
+		return imageSet.jsStepImage, nil
+	case "sqlc":
+		return imageSet.sqlcStepImage, nil
+	default:
+		return "", fmt.Errorf("unsupported language '%s'", lang)
+	}
+}
+
+// recordImage stores an image reference found in an existing CI file against the step type it is used for, based on the name of the job that used it.
+func (s *ResourceSet) recordImage(jobName string, image string) {
+	switch {
+	case jobName == "ci-all":
+		s.utilStepImage = image
+	case strings.HasPrefix(jobName, "img-"), strings.HasPrefix(jobName, "publish-"):
+		s.imgStepImage = image
+	case strings.HasPrefix(jobName, "check-"):
+		// project names may contain dashes, but languages never do
+		language := jobName[strings.LastIndex(jobName, "-")+1:]
+		switch language {
+		case "buf":
+			s.bufStepImage = image
+		case "go":
+			s.goStepImage = image
+		case "js":
+			s.jsStepImage = image
+		case "sqlc":
+			s.sqlcStepImage = image
+		}
+	}
+}
+
+func (s *ResourceSet) populateMissingResources() {
+	// these defaults will slowly get out of date, but they will only be applied to first-time ci and Renovate will update them anyway
+
+	if s.bufStepImage == "" {
+		s.bufStepImage = "docker.io/bufbuild/buf:1.61.0"
+	}
+
+	if s.goStepImage == "" {
+		s.goStepImage = "docker.io/golang:1.26.0"
+	}
+
+	if s.imgStepImage == "" || !strings.Contains(s.imgStepImage, "-immutable") {
+		s.imgStepImage = "quay.io/podman/stable:v5.7.1-immutable"
+	}
+
+	if s.jsStepImage == "" || strings.Contains(s.jsStepImage, "-slim") {
+		s.jsStepImage = "docker.io/node:25.9.0"
+	}
+
+	if s.sqlcStepImage == "" {
+		s.sqlcStepImage = "docker.io/sqlc/sqlc:1.28.0"
+	}
+
+	if s.utilStepImage == "" {
+		s.utilStepImage = "docker.io/busybox:1.37.0"
+	}
+}
@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/imgrefs"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/lanuages"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/util"
+)
+
+const generatedFileHeader = "# This file is maintained by Tedium - manual edits will be overwritten!"
+
+// Options controls how a project is generated. The zero value generates GitHub Actions config.
+type Options struct {
+	// PrivateGitDomain switches CI output to Forgejo Actions.
+	PrivateGitDomain string
+
+	// PlatformType is the type of platform hosting the repo, as reported by Tedium. "gitlab" switches CI output to GitLab CI.
+	PlatformType string
+
+	// DefaultBranch is the branch that images are published from. Defaults to "main".
+	DefaultBranch string
+
+	// Config is layered on top of the config file in the project, if there is one.
+	Config config.Config
+}
+
+// Result is the set of changes that a call to Generate would make to a project.
+type Result struct {
+	Files     []File
+	Deletions []string
+}
+
+// File is a single generated file, with a path relative to the project root.
+type File struct {
+	Path     string
+	Contents []byte
+}
+
+// Generate computes the Taskfile, CI config and supporting files for the project at projectPath. Nothing is written to disk; see Result.Apply.
+func Generate(ctx context.Context, projectPath string, opts Options) (Result, error) {
+	projectPath = strings.TrimRight(projectPath, "/")
+
+	projectPathExists, err := util.DirExists(projectPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("error checking whether project path exists: %w", err)
+	}
+
+	if !projectPathExists {
+		return Result{}, fmt.Errorf("project path does not exist: %s", projectPath)
+	}
+
+	fileConfig, err := config.Load(projectPath)
+	if err != nil {
+		return Result{}, err
+	}
+	cfg := fileConfig.Merge(opts.Config)
+
+	cache, err := cacheBackend(cfg.CI.Cache)
+	if err != nil {
+		return Result{}, err
+	}
+	imageTags, err := imgrefs.ParseStrategies(cfg.Images.Tags)
+	if err != nil {
+		return Result{}, fmt.Errorf("error reading image tag config: %w", err)
+	}
+
+	scanner, err := lanuages.NewImageScanner(cfg.Images.Scan)
+	if err != nil {
+		return Result{}, err
+	}
+
+	settings := lanuages.Settings{Cache: cache, ImageTags: imageTags, ImageScan: scanner}
+
+	result := Result{}
+
+	taskFile, gitignores, err := generateTaskfile(ctx, projectPath, cfg, settings)
+	if err != nil {
+		return Result{}, err
+	}
+
+	taskFileOutput, err := encodeTaskfile(taskFile)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result.Files = append(result.Files, gitignores...)
+	result.Files = append(result.Files, File{Path: "taskfile.yml", Contents: taskFileOutput})
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	ciFile, err := generateCIConfig(projectPath, taskFile, opts, cfg, settings)
+	if err != nil {
+		return Result{}, err
+	}
+	result.Files = append(result.Files, ciFile)
+
+	result.Deletions = []string{".circleci", ".drone.yml"}
+
+	return result, nil
+}
+
+// Apply writes the result to the project at projectPath.
+func (r Result) Apply(projectPath string) error {
+	for _, f := range r.Files {
+		outputPath := path.Join(projectPath, f.Path)
+
+		err := os.MkdirAll(path.Dir(outputPath), 0755)
+		if err != nil {
+			return fmt.Errorf("error creating directory for %s: %w", f.Path, err)
+		}
+
+		err = os.WriteFile(outputPath, f.Contents, 0644)
+		if err != nil {
+			return fmt.Errorf("error writing %s: %w", f.Path, err)
+		}
+	}
+
+	for _, p := range r.Deletions {
+		err := os.RemoveAll(path.Join(projectPath, p))
+		if err != nil {
+			return fmt.Errorf("error deleting %s: %w", p, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package generator
+
+import (
+	"context"
+	"flag"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Options Options
+	}{
+		{Name: "buf"},
+		{Name: "container-image"},
+		{Name: "go"},
+		{Name: "goverter"},
+		{Name: "js"},
+		{Name: "sqlc"},
+		{Name: "monorepo", Options: Options{PrivateGitDomain: "git.example.com"}},
+		{Name: "runtime", Options: Options{Config: config.FromEnv([]string{"GO_RUNTIME_PACKAGES=libusb-1.0-0-dev pkg-config", "GO_RUNTIME_ENV_GOFLAGS=-tags=usb"})}},
+		{Name: "gitlab", Options: Options{PlatformType: "gitlab"}},
+		{Name: "woodpecker", Options: Options{PrivateGitDomain: "git.example.com"}},
+		{Name: "native-cache"},
+		{Name: "triggers", Options: Options{DefaultBranch: "develop"}},
+		{Name: "registries"},
+		{Name: "container-test"},
+		{Name: "overrides", Options: Options{Config: config.FromEnv([]string{"JS_RUNTIME_ENV_NODE_OPTIONS=--max-old-space-size=4096"})}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			repoPath := path.Join("testdata", c.Name, "repo")
+			goldenPath := path.Join("testdata", c.Name, "golden")
+
+			result, err := Generate(context.Background(), repoPath, c.Options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if *update {
+				writeGoldenFiles(t, goldenPath, result)
+			}
+
+			expectedPaths := readGoldenPaths(t, goldenPath)
+			actualPaths := []string{}
+			for _, f := range result.Files {
+				actualPaths = append(actualPaths, f.Path)
+
+				expected, err := os.ReadFile(path.Join(goldenPath, f.Path))
+				if err != nil {
+					t.Errorf("missing golden file for %s: %v", f.Path, err)
+					continue
+				}
+
+				if string(expected) != string(f.Contents) {
+					t.Errorf("output for %s does not match golden file\n--- expected\n%s\n--- actual\n%s", f.Path, expected, f.Contents)
+				}
+			}
+
+			slices.Sort(actualPaths)
+			if !slices.Equal(actualPaths, expectedPaths) {
+				t.Errorf("generated files do not match golden files\nexpected: %v\nactual:   %v", expectedPaths, actualPaths)
+			}
+		})
+	}
+}
+
+func TestGenerateMissingProject(t *testing.T) {
+	_, err := Generate(context.Background(), path.Join("testdata", "does-not-exist"), Options{})
+	if err == nil {
+		t.Error("expected an error for a missing project path")
+	}
+}
+
+func TestGenerateNameCollision(t *testing.T) {
+	repoPath := t.TempDir()
+	for _, dir := range []string{"api-v1", "apiv1"} {
+		err := os.MkdirAll(path.Join(repoPath, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path.Join(repoPath, dir, "go.mod"), []byte("module example.com/"+dir+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := Generate(context.Background(), repoPath, Options{})
+	if err == nil {
+		t.Fatal("expected an error for colliding task names")
+	}
+
+	if !strings.Contains(err.Error(), "api-v1") || !strings.Contains(err.Error(), "apiv1") {
+		t.Errorf("expected error to name both projects, got: %v", err)
+	}
+}
+
+func writeGoldenFiles(t *testing.T, goldenPath string, result Result) {
+	t.Helper()
+
+	err := os.RemoveAll(goldenPath)
+	if err != nil {
+		t.Fatalf("error clearing golden files: %v", err)
+	}
+
+	err = result.Apply(goldenPath)
+	if err != nil {
+		t.Fatalf("error writing golden files: %v", err)
+	}
+}
+
+func readGoldenPaths(t *testing.T, goldenPath string) []string {
+	t.Helper()
+
+	paths := []string{}
+	err := filepath.WalkDir(goldenPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			relativePath, err := filepath.Rel(goldenPath, p)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(relativePath))
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error reading golden files: %v", err)
+	}
+
+	slices.Sort(paths)
+	return paths
+}
@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+)
+
+// task types that receive the per-language runtime customisations
+var runtimeTaskTypes = []string{"lint", "test"}
+
+func isProjectSkipped(cfg config.Config, relativePath string) bool {
+	for _, p := range cfg.ProjectsAt(relativePath, "") {
+		if p.Skip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyProjectConfig removes, rewrites and adds env to layer-3 tasks according to the project and language config.
+func applyProjectConfig(taskFile *task.TaskFile, cfg config.Config) {
+	// sort names so that the outcome doesn't depend on map ordering
+	names := slices.Sorted(maps.Keys(taskFile.Tasks))
+
+	for _, name := range names {
+		t := taskFile.Tasks[name]
+
+		env := map[string]string{}
+		if slices.Contains(runtimeTaskTypes, t.ID.Type) {
+			maps.Copy(env, cfg.Languages[t.ID.Language].RuntimeEnv)
+		}
+
+		removed := false
+		for _, p := range cfg.ProjectsAt(t.Source, t.ID.Language) {
+			if p.Skip || slices.Contains(p.Disable, t.ID.Type) {
+				delete(taskFile.Tasks, name)
+				removed = true
+				break
+			}
+
+			if cmd, ok := p.Commands[t.ID.Type]; ok {
+				t.Commands = []task.Command{{Command: cmd}}
+			}
+
+			maps.Copy(env, p.Env)
+		}
+
+		if removed || len(env) == 0 {
+			continue
+		}
+
+		if t.Environment == nil {
+			t.Environment = map[string]string{}
+		}
+		maps.Copy(t.Environment, env)
+	}
+
+	// tasks that depend on a disabled task are kept, but run without it
+	for _, name := range slices.Sorted(maps.Keys(taskFile.Tasks)) {
+		t := taskFile.Tasks[name]
+		t.Dependencies = slices.DeleteFunc(t.Dependencies, func(dep string) bool {
+			if _, ok := taskFile.Tasks[dep]; ok {
+				return false
+			}
+
+			slog.Warn("task depends on a disabled task, which will not be run", "task", name, "dependency", dep)
+			return true
+		})
+	}
+
+	// command overrides that didn't match anything are almost certainly a mistake, but not one worth failing for
+	for _, p := range cfg.Projects {
+		for taskType := range p.Commands {
+			matched := false
+			for _, t := range taskFile.Tasks {
+				if t.Source == p.Path && t.ID.Type == taskType && (p.Language == "" || p.Language == t.ID.Language) {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				slog.Warn("command override does not match any task", "path", p.Path, "language", p.Language, "task", taskType)
+			}
+		}
+	}
+}
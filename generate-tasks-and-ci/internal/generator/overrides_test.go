@@ -0,0 +1,42 @@
+package generator
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+)
+
+func TestApplyProjectConfigDisable(t *testing.T) {
+	taskFile := task.TaskFile{Tasks: map[string]*task.Task{}}
+	for _, id := range []task.ID{
+		{Type: "deps", Project: "api", Language: "go"},
+		{Type: "lint", Project: "api", Language: "go"},
+		{Type: "test", Project: "api", Language: "go"},
+	} {
+		deps := []string{}
+		if id.Type != "deps" {
+			deps = append(deps, task.ID{Type: "deps", Project: "api", Language: "go"}.Name())
+		}
+
+		err := taskFile.AddTask(id, "api", &task.Task{Dependencies: deps})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applyProjectConfig(&taskFile, config.Config{Projects: []config.ProjectConfig{{Path: "api", Disable: []string{"deps"}}}})
+
+	names := slices.Sorted(maps.Keys(taskFile.Tasks))
+	if expected := []string{"lint-api-go", "test-api-go"}; !slices.Equal(names, expected) {
+		t.Fatalf("expected only the disabled task to be removed, leaving %v, got %v", expected, names)
+	}
+
+	for name, tsk := range taskFile.Tasks {
+		if len(tsk.Dependencies) > 0 {
+			t.Errorf("expected %s to lose its dependency on the disabled task, got %v", name, tsk.Dependencies)
+		}
+	}
+}
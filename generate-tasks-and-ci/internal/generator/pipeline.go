@@ -0,0 +1,458 @@
+package generator
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/ci"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/lanuages"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/util"
+)
+
+// default job timeouts in minutes, by job type - generous enough for a cold cache, short enough that a hung build doesn't hold a runner for hours
+var defaultJobTimeouts = map[string]int{
+	"all":   5,
+	"check": 30,
+	"img":   60,
+}
+
+// tasks run by the check, img and publish jobs, in order
+var (
+	ciCheckTasks   = []string{"cacheload", "deps", "lint", "test", "cachesave"}
+	ciImgTasks     = []string{"imgrefs", "imgbuild", "imgtest", "imgscan"}
+	ciPublishTasks = []string{"imgrefs", "imgbuild", "imgscan", "imgpush"}
+)
+
+// globs whose changes run every job when path filters are enabled: files in the repo root (e.g. go.work, lockfiles and this tool's config) and CI config
+var defaultSharedPaths = []string{"*", ".github/**", ".forgejo/**", ".woodpecker/**"}
+
+// buildPipeline turns the public tasks in the taskfile into the platform-neutral CI job graph.
+func buildPipeline(taskfile *task.TaskFile, opts Options, cfg config.Config, settings lanuages.Settings, resourceSet ResourceSet) (ci.Pipeline, error) {
+	defaultBranch := opts.DefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+
+	timeouts := maps.Clone(defaultJobTimeouts)
+	maps.Copy(timeouts, cfg.CI.Timeouts)
+
+	jobs := map[string]ci.Job{}
+	needs := map[string][]*regexp.Regexp{}
+
+	projectsToLanguages := collectProjectLanguages(taskfile)
+	hasTask := func(id task.ID) bool {
+		t, ok := taskfile.Tasks[id.Name()]
+		return ok && !t.Internal
+	}
+
+	// create per-project, per-language check jobs
+	for project, languages := range projectsToLanguages {
+		for language := range languages {
+			job := ci.Job{
+				Name:           fmt.Sprintf("check-%s-%s", project, language),
+				Kind:           ci.JobCheck,
+				TimeoutMinutes: timeouts["check"],
+				Cancellable:    true,
+				Steps: []ci.Step{
+					{Kind: ci.StepInstallTools},
+				},
+			}
+
+			// handle language-specific setup steps
+			switch language {
+			case "js":
+				job.Steps = append(job.Steps, ci.Step{Kind: ci.StepSetup, Run: "npm install -g --force yarn pnpm"})
+			}
+
+			// handle user-specified runtime customisations
+			runtime := cfg.Languages[language]
+			if len(runtime.RuntimePackages) > 0 {
+				job.Steps = append(job.Steps, ci.Step{Kind: ci.StepSetup, Run: runtimePackagesCommand(runtime.RuntimePackages)})
+			}
+			if len(runtime.RuntimeEnv) > 0 {
+				job.Env = maps.Clone(runtime.RuntimeEnv)
+			}
+
+			// native caches are handled by the platform, using the files written by the cachekey and cachepaths tasks
+			cacheKeyID := task.ID{Type: "cachekey", Project: project, Language: language}
+			cachePathsID := task.ID{Type: "cachepaths", Project: project, Language: language}
+			if _, native := settings.Cache.(lanuages.NativeCache); native && hasTask(cacheKeyID) && hasTask(cachePathsID) {
+				dir := taskfile.Tasks[cacheKeyID.Name()].Source
+				job.Steps = append(job.Steps, ci.Step{
+					Kind: ci.StepNativeCache,
+					Run:  fmt.Sprintf("./task -s %s %s", cacheKeyID.Name(), cachePathsID.Name()),
+					Cache: &ci.StepCache{
+						KeyFile:   path.Join(dir, ".task-meta-cache-key"),
+						PathsFile: path.Join(dir, ".task-meta-cache-paths"),
+					},
+				})
+			}
+
+			checkTasks := []*task.Task{}
+			for _, checkTask := range ciCheckTasks {
+				id := task.ID{Type: checkTask, Project: project, Language: language}
+				if !hasTask(id) {
+					continue
+				}
+				checkTasks = append(checkTasks, taskfile.Tasks[id.Name()])
+
+				step := ci.Step{Kind: ci.StepRun, Run: fmt.Sprintf("./task -s %s", id.Name())}
+				if strings.HasPrefix(checkTask, "cache") && len(settings.Cache.Secrets()) > 0 {
+					step.Secrets = map[string]string{}
+					for _, secret := range settings.Cache.Secrets() {
+						step.Secrets[secret] = secret
+					}
+				}
+
+				job.Steps = append(job.Steps, step)
+			}
+
+			// bail out if this project/language combo doesn't actually have any check tasks
+			if len(checkTasks) == 0 {
+				continue
+			}
+
+			source := checkTasks[0].Source
+			job.Paths = jobPaths(cfg.CI.PathFilters, source)
+			job.AllowSkip = len(job.Paths) > 0
+
+			// upload artifacts and summarise them even if the checks failed, because that's when they're most useful
+			artifacts := jobArtifacts(job.Name, source, checkTasks, cfg.ProjectsAt(source, language))
+			for _, artifact := range artifacts {
+				job.Steps = append(job.Steps, ci.Step{Kind: ci.StepUploadArtifact, Always: true, Artifact: &artifact})
+			}
+			if len(artifacts) > 0 {
+				job.Steps = append(job.Steps, ci.Step{Kind: ci.StepSummary, Always: true, Run: artifactSummaryCommand(job.Name, artifacts)})
+			}
+
+			image, err := getImageForLanguageTask(resourceSet, language)
+			if err != nil {
+				return ci.Pipeline{}, fmt.Errorf("unable to get image for language task: %w", err)
+			}
+			job.Image = image
+
+			jobs[job.Name] = job
+		}
+	}
+
+	// create per-project image jobs: img checks that the image builds on every run, and publish pushes it on release refs only
+	for project := range projectsToLanguages {
+		job := ci.Job{
+			Name:           fmt.Sprintf("img-%s", project),
+			Kind:           ci.JobImage,
+			Image:          resourceSet.imgStepImage,
+			TimeoutMinutes: timeouts["img"],
+			Steps: []ci.Step{
+				{Kind: ci.StepInstallTools},
+			},
+		}
+
+		imgTasks := []*task.Task{}
+		for _, imgTask := range ciImgTasks {
+			id := task.ID{Type: imgTask, Project: project}
+			if !hasTask(id) {
+				continue
+			}
+			imgTasks = append(imgTasks, taskfile.Tasks[id.Name()])
+
+			job.Steps = append(job.Steps, imgTaskStep(id, settings))
+		}
+
+		// bail out if this project doesn't actually have any img tasks
+		if len(imgTasks) == 0 {
+			continue
+		}
+		source := imgTasks[0].Source
+
+		// the vulnerability database is cached natively like any other, using the key that the imgscan task would use
+		scanID := task.ID{Type: "imgscan", Project: project}
+		if _, native := settings.Cache.(lanuages.NativeCache); native && hasTask(scanID) && settings.ImageScan.DBDir == "" {
+			dir := path.Join(source, lanuages.ImageScanDir)
+			cacheStep := ci.Step{
+				Kind: ci.StepNativeCache,
+				Run: fmt.Sprintf(
+					`mkdir -p %[1]s && %[2]s > %[1]s/.task-meta-cache-key && echo "%[1]s/db" > %[1]s/.task-meta-cache-paths`,
+					dir, settings.ImageScan.CacheKeyCommand(),
+				),
+				Cache: &ci.StepCache{
+					KeyFile:   path.Join(dir, ".task-meta-cache-key"),
+					PathsFile: path.Join(dir, ".task-meta-cache-paths"),
+				},
+			}
+			job.Steps = slices.Insert(job.Steps, 1, cacheStep)
+		}
+
+		// jobs don't share a container store, so on release refs the image is exported for the publish job to load instead of building it again
+		pushID := task.ID{Type: "imgpush", Project: project}
+		saveID := task.ID{Type: "imgsave", Project: project}
+		imageArtifact := ci.StepArtifact{
+			Name:  fmt.Sprintf("%s-image", job.Name),
+			Kind:  string(task.ArtifactImage),
+			Paths: []string{path.Join(source, lanuages.ImageSaveFile)},
+		}
+		if hasTask(pushID) && hasTask(saveID) {
+			job.Steps = append(
+				job.Steps,
+				ci.Step{Kind: ci.StepRun, PublishOnly: true, Run: fmt.Sprintf("./task -s %s", saveID.Name())},
+				ci.Step{Kind: ci.StepUploadArtifact, PublishOnly: true, Artifact: &imageArtifact},
+			)
+		}
+
+		// scan reports are uploaded from the img job, which runs on every change
+		artifacts := jobArtifacts(job.Name, source, imgTasks, nil)
+		for _, artifact := range artifacts {
+			job.Steps = append(job.Steps, ci.Step{Kind: ci.StepUploadArtifact, Always: true, Artifact: &artifact})
+		}
+		if len(artifacts) > 0 {
+			job.Steps = append(job.Steps, ci.Step{Kind: ci.StepSummary, Always: true, Run: artifactSummaryCommand(job.Name, artifacts)})
+		}
+
+		job.Paths = jobPaths(cfg.CI.PathFilters, source)
+		job.AllowSkip = len(job.Paths) > 0
+
+		jobs[job.Name] = job
+		needs[job.Name] = []*regexp.Regexp{
+			regexp.MustCompile(`^check\-` + project + `\-.*`),
+		}
+
+		if !hasTask(pushID) {
+			continue
+		}
+
+		publishJob := ci.Job{
+			Name:           fmt.Sprintf("publish-%s", project),
+			Kind:           ci.JobPublish,
+			Image:          resourceSet.imgStepImage,
+			TimeoutMinutes: timeouts["img"],
+			AllowSkip:      true,
+			Paths:          job.Paths,
+			Steps: []ci.Step{
+				{Kind: ci.StepInstallTools},
+			},
+		}
+
+		if hasTask(saveID) {
+			publishJob.Steps = append(publishJob.Steps, ci.Step{Kind: ci.StepDownloadArtifact, Artifact: &imageArtifact})
+		}
+
+		registry := taskfile.Tasks[pushID.Name()].Registry
+
+		// the job's own token needs packages: write to push to GHCR; other registries have their own credentials
+		if host, _, _ := strings.Cut(registry, "/"); host == "ghcr.io" {
+			publishJob.Permissions = map[string]string{"packages": "write"}
+		}
+
+		if registry != "" {
+			step, err := registryLoginStep(registry, cfg.CI.Registries)
+			if err != nil {
+				return ci.Pipeline{}, err
+			}
+			publishJob.Steps = append(publishJob.Steps, step)
+		}
+
+		for _, publishTask := range ciPublishTasks {
+			id := task.ID{Type: publishTask, Project: project}
+			if hasTask(id) {
+				publishJob.Steps = append(publishJob.Steps, imgTaskStep(id, settings))
+			}
+		}
+
+		jobs[publishJob.Name] = publishJob
+		needs[publishJob.Name] = []*regexp.Regexp{
+			regexp.MustCompile(`^` + regexp.QuoteMeta(job.Name) + `$`),
+		}
+	}
+
+	// resolve needs and order jobs by name so that output is stable
+	pipeline := ci.Pipeline{
+		DefaultBranch: defaultBranch,
+		Triggers:      buildTriggers(cfg.CI.Triggers, defaultBranch),
+	}
+
+	allJobsNames := slices.Sorted(maps.Keys(jobs))
+	for _, name := range allJobsNames {
+		job := jobs[name]
+		job.Needs = util.MatchingStrings(allJobsNames, needs[name])
+		pipeline.Jobs = append(pipeline.Jobs, job)
+	}
+
+	// the aggregate job needs every other job by name, so that none can be missed by a pattern
+	pipeline.Jobs = append(pipeline.Jobs, ci.Job{
+		Name:           "ci-all",
+		Kind:           ci.JobAggregate,
+		Image:          resourceSet.utilStepImage,
+		Needs:          allJobsNames,
+		TimeoutMinutes: timeouts["all"],
+	})
+	slices.SortFunc(pipeline.Jobs, func(a ci.Job, b ci.Job) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return pipeline, nil
+}
+
+// imgTaskStep runs an img task, giving the imgscan task the cache backend's secrets for its vulnerability database.
+func imgTaskStep(id task.ID, settings lanuages.Settings) ci.Step {
+	step := ci.Step{Kind: ci.StepRun, Run: fmt.Sprintf("./task -s %s", id.Name())}
+
+	if id.Type == "imgscan" && settings.ImageScan != nil && settings.ImageScan.DBDir == "" && len(settings.Cache.Secrets()) > 0 {
+		step.Secrets = map[string]string{}
+		for _, secret := range settings.Cache.Secrets() {
+			step.Secrets[secret] = secret
+		}
+	}
+
+	return step
+}
+
+// registryLoginStep logs in to a registry with its configured credentials, or the platform's own if there are none.
+func registryLoginStep(host string, registries map[string]config.RegistryConfig) (ci.Step, error) {
+	step := ci.Step{
+		Kind:     ci.StepRegistryLogin,
+		Registry: &ci.StepRegistry{Host: host},
+	}
+
+	registry, ok := registries[host]
+	if !ok {
+		return step, nil
+	}
+
+	if registry.PasswordSecret == "" || (registry.Username == "") == (registry.UsernameSecret == "") {
+		return ci.Step{}, fmt.Errorf("registry %s needs a passwordSecret and exactly one of username or usernameSecret", host)
+	}
+
+	step.Registry.Username = registry.Username
+	step.Registry.UsernameSecret = registry.UsernameSecret
+	step.Registry.PasswordSecret = registry.PasswordSecret
+
+	// secrets are exposed under their own names, which is what GitLab does anyway
+	step.Secrets = map[string]string{registry.PasswordSecret: registry.PasswordSecret}
+	if registry.UsernameSecret != "" {
+		step.Secrets[registry.UsernameSecret] = registry.UsernameSecret
+	}
+
+	return step, nil
+}
+
+// jobPaths returns the globs that a project's jobs are filtered on, or nothing if they should always run. A project at the repo root is affected by every change.
+func jobPaths(cfg config.PathFiltersConfig, source string) []string {
+	if !cfg.Enabled || source == "." {
+		return nil
+	}
+
+	paths := []string{path.Join(source, "**")}
+	paths = append(paths, defaultSharedPaths...)
+	return append(paths, cfg.Shared...)
+}
+
+// jobArtifacts collects the artifacts declared by a job's tasks and by the project config, named uniquely for the pipeline. Config artifacts replace task artifacts with the same name.
+func jobArtifacts(jobName string, source string, tasks []*task.Task, projectConfigs []config.ProjectConfig) []ci.StepArtifact {
+	artifacts := []ci.StepArtifact{}
+	indexes := map[string]int{}
+
+	add := func(name string, kind string, paths []string) {
+		artifact := ci.StepArtifact{Name: fmt.Sprintf("%s-%s", jobName, name), Kind: kind}
+		for _, p := range paths {
+			artifact.Paths = append(artifact.Paths, path.Join(source, p))
+		}
+
+		if i, ok := indexes[name]; ok {
+			artifacts[i] = artifact
+		} else {
+			indexes[name] = len(artifacts)
+			artifacts = append(artifacts, artifact)
+		}
+	}
+
+	for _, t := range tasks {
+		for _, a := range t.Artifacts {
+			add(a.Name, string(a.Kind), a.Paths)
+		}
+	}
+
+	for _, p := range projectConfigs {
+		for _, a := range p.Artifacts {
+			add(a.Name, a.Kind, a.Paths)
+		}
+	}
+
+	return artifacts
+}
+
+// artifactSummaryCommand prints a Markdown table of the job's artifacts, with test counts for JUnit reports.
+func artifactSummaryCommand(jobName string, artifacts []ci.StepArtifact) string {
+	lines := []string{
+		fmt.Sprintf(`echo "### %s"`, jobName),
+		`echo ""`,
+		`echo "| Artifact | Files | Details |"`,
+		`echo "| --- | --- | --- |"`,
+	}
+
+	for _, a := range artifacts {
+		quoted := make([]string, len(a.Paths))
+		for i, p := range a.Paths {
+			quoted[i] = strconv.Quote(p)
+		}
+		paths := strings.Join(quoted, " ")
+
+		details := a.Kind
+		if a.Kind == string(task.ArtifactTestReport) {
+			details = fmt.Sprintf(
+				`$(cat %[1]s 2>/dev/null | grep -o '<testcase' | wc -l) tests, $(cat %[1]s 2>/dev/null | grep -o '<failure' | wc -l) failures`,
+				paths,
+			)
+		}
+
+		lines = append(lines, fmt.Sprintf(`echo "| %s | $(ls -d %s 2>/dev/null | wc -l) | %s |"`, a.Name, paths, details))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// collectProjectLanguages maps each project with public tasks to the languages it has tasks for.
+func collectProjectLanguages(taskfile *task.TaskFile) map[string]map[string]struct{} {
+	projectsToLanguages := map[string]map[string]struct{}{}
+	for _, t := range taskfile.Tasks {
+		if t.Internal || t.ID.Type == "" {
+			continue
+		}
+
+		if _, ok := projectsToLanguages[t.ID.Project]; !ok {
+			projectsToLanguages[t.ID.Project] = map[string]struct{}{}
+		}
+
+		if t.ID.Language != "" {
+			projectsToLanguages[t.ID.Project][t.ID.Language] = struct{}{}
+		}
+	}
+
+	return projectsToLanguages
+}
+
+// buildTriggers applies the repo's trigger overrides to the defaults: pushes to the default branch and tags, all PRs, and manual runs.
+func buildTriggers(cfg config.TriggersConfig, defaultBranch string) ci.Triggers {
+	triggers := ci.Triggers{
+		PushBranches:     []string{defaultBranch},
+		PushTags:         []string{"**"},
+		PullRequest:      cfg.PullRequest == nil || *cfg.PullRequest,
+		Schedule:         cfg.Schedule,
+		WorkflowDispatch: cfg.WorkflowDispatch == nil || *cfg.WorkflowDispatch,
+	}
+
+	if cfg.PushBranches != nil {
+		triggers.PushBranches = cfg.PushBranches
+	}
+
+	if cfg.PushTags != nil {
+		triggers.PushTags = cfg.PushTags
+	}
+
+	return triggers
+}
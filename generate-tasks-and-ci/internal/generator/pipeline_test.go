@@ -0,0 +1,216 @@
+package generator
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/ci"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/lanuages"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+)
+
+func TestBuildPipeline(t *testing.T) {
+	taskFile := &task.TaskFile{Tasks: map[string]*task.Task{}}
+	ids := []task.ID{
+		{Type: "lint", Project: "api", Language: "go"},
+		{Type: "test", Project: "api", Language: "go"},
+		{Type: "imgbuild", Project: "api"},
+		{Type: "imgsave", Project: "api"},
+		{Type: "imgpush", Project: "api"},
+		{Type: "lint", Project: "web", Language: "js"},
+	}
+	for _, id := range ids {
+		err := taskFile.AddTask(id, id.Project, &task.Task{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	taskFile.Tasks["imgpush-api"].Registry = "ghcr.io"
+
+	// internal tasks never get CI jobs
+	err := taskFile.AddTask(task.ID{Type: "test", Project: "tools", Language: "go"}, "tools", &task.Task{Internal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resourceSet := ResourceSet{}
+	resourceSet.populateMissingResources()
+
+	pipeline, err := buildPipeline(taskFile, Options{DefaultBranch: "develop"}, config.Config{}, lanuages.Settings{Cache: lanuages.NoCache{}}, resourceSet)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jobs := map[string]ci.Job{}
+	names := []string{}
+	for _, job := range pipeline.Jobs {
+		jobs[job.Name] = job
+		names = append(names, job.Name)
+	}
+
+	expectedNames := []string{"check-api-go", "check-web-js", "ci-all", "img-api", "publish-api"}
+	if !slices.Equal(names, expectedNames) {
+		t.Fatalf("expected jobs %v, got %v", expectedNames, names)
+	}
+
+	if needs := jobs["img-api"].Needs; !slices.Equal(needs, []string{"check-api-go"}) {
+		t.Errorf("expected img-api to need check-api-go, got %v", needs)
+	}
+
+	if needs := jobs["publish-api"].Needs; !slices.Equal(needs, []string{"img-api"}) {
+		t.Errorf("expected publish-api to need img-api, got %v", needs)
+	}
+
+	if needs := jobs["ci-all"].Needs; !slices.Equal(needs, []string{"check-api-go", "check-web-js", "img-api", "publish-api"}) {
+		t.Errorf("expected ci-all to need every other job, got %v", needs)
+	}
+
+	// only the publish job logs in, pushes and gets write permissions
+	stepsOf := func(job ci.Job) []string {
+		steps := []string{}
+		for _, step := range job.Steps {
+			steps = append(steps, string(step.Kind)+":"+step.Run)
+		}
+		return steps
+	}
+
+	// the img job exports the image on release refs, and the publish job loads it instead of building it again
+	expectedImgSteps := []string{"install-tools:", "run:./task -s imgbuild-api", "run:./task -s imgsave-api", "upload-artifact:"}
+	if steps := stepsOf(jobs["img-api"]); !slices.Equal(steps, expectedImgSteps) || jobs["img-api"].Permissions != nil {
+		t.Errorf("expected img-api to only build and save, got steps %v and permissions %v", steps, jobs["img-api"].Permissions)
+	}
+	for _, step := range jobs["img-api"].Steps[2:] {
+		if !step.PublishOnly {
+			t.Errorf("expected saving the image to be limited to release refs, got %+v", step)
+		}
+	}
+
+	expectedPublishSteps := []string{"install-tools:", "download-artifact:", "registry-login:", "run:./task -s imgbuild-api", "run:./task -s imgpush-api"}
+	if steps := stepsOf(jobs["publish-api"]); !slices.Equal(steps, expectedPublishSteps) {
+		t.Errorf("expected publish steps %v, got %v", expectedPublishSteps, steps)
+	}
+
+	if !jobs["publish-api"].AllowSkip || jobs["publish-api"].Permissions["packages"] != "write" {
+		t.Errorf("expected publish-api to be skippable with write permissions, got %+v", jobs["publish-api"])
+	}
+
+	if artifact := jobs["publish-api"].Steps[1].Artifact; artifact == nil || !slices.Equal(artifact.Paths, []string{"api/.task-meta-imgsave.tar"}) {
+		t.Errorf("expected publish-api to download the saved image, got %+v", artifact)
+	}
+
+	if pipeline.DefaultBranch != "develop" || !slices.Equal(pipeline.Triggers.PushBranches, []string{"develop"}) {
+		t.Errorf("expected the default branch to be used for triggers, got %+v", pipeline.Triggers)
+	}
+}
+
+func TestBuildPipelinePermissions(t *testing.T) {
+	resourceSet := ResourceSet{}
+	resourceSet.populateMissingResources()
+
+	for registry, expected := range map[string]map[string]string{
+		"ghcr.io":           {"packages": "write"},
+		"ghcr.io/someone":   {"packages": "write"},
+		"docker.io":         nil,
+		"git.example.com/x": nil,
+	} {
+		taskFile := &task.TaskFile{Tasks: map[string]*task.Task{}}
+		for _, id := range []task.ID{{Type: "imgbuild", Project: "api"}, {Type: "imgpush", Project: "api"}} {
+			err := taskFile.AddTask(id, "api", &task.Task{Registry: registry})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		pipeline, err := buildPipeline(taskFile, Options{}, config.Config{}, lanuages.Settings{Cache: lanuages.NoCache{}}, resourceSet)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		i := slices.IndexFunc(pipeline.Jobs, func(job ci.Job) bool { return job.Kind == ci.JobPublish })
+		if i < 0 {
+			t.Fatalf("expected a publish job for %s", registry)
+		}
+		if permissions := pipeline.Jobs[i].Permissions; !maps.Equal(permissions, expected) {
+			t.Errorf("expected permissions %v for %s, got %v", expected, registry, permissions)
+		}
+	}
+}
+
+func TestJobArtifacts(t *testing.T) {
+	tasks := []*task.Task{
+		{Artifacts: []task.Artifact{
+			{Name: "junit", Kind: task.ArtifactTestReport, Paths: []string{"report.xml"}},
+			{Name: "coverage", Kind: task.ArtifactCoverage, Paths: []string{"coverage.out"}},
+		}},
+	}
+	projectConfigs := []config.ProjectConfig{
+		{Path: "api", Artifacts: []config.ArtifactConfig{
+			{Name: "coverage", Kind: "coverage", Paths: []string{"out/coverage.out"}},
+			{Name: "binary", Kind: "binary", Paths: []string{"bin/api"}},
+		}},
+	}
+
+	artifacts := jobArtifacts("check-api-go", "api", tasks, projectConfigs)
+
+	// config artifacts replace task artifacts with the same name, keeping their position
+	expected := []ci.StepArtifact{
+		{Name: "check-api-go-junit", Kind: "junit", Paths: []string{"api/report.xml"}},
+		{Name: "check-api-go-coverage", Kind: "coverage", Paths: []string{"api/out/coverage.out"}},
+		{Name: "check-api-go-binary", Kind: "binary", Paths: []string{"api/bin/api"}},
+	}
+	if !slices.EqualFunc(artifacts, expected, func(a ci.StepArtifact, b ci.StepArtifact) bool {
+		return a.Name == b.Name && a.Kind == b.Kind && slices.Equal(a.Paths, b.Paths)
+	}) {
+		t.Errorf("expected artifacts %+v, got %+v", expected, artifacts)
+	}
+}
+
+func TestJobPaths(t *testing.T) {
+	cfg := config.PathFiltersConfig{Enabled: true, Shared: []string{"proto/**"}}
+
+	expected := []string{"api/**", "*", ".github/**", ".forgejo/**", ".woodpecker/**", "proto/**"}
+	if paths := jobPaths(cfg, "api"); !slices.Equal(paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+
+	// every change is within a project at the root, so it's never filtered
+	if paths := jobPaths(cfg, "."); paths != nil {
+		t.Errorf("expected no paths for the root project, got %v", paths)
+	}
+
+	if paths := jobPaths(config.PathFiltersConfig{}, "api"); paths != nil {
+		t.Errorf("expected no paths when filters are disabled, got %v", paths)
+	}
+}
+
+func TestRegistryLoginStep(t *testing.T) {
+	registries := map[string]config.RegistryConfig{
+		"docker.io": {Username: "example", PasswordSecret: "DOCKERHUB_TOKEN"},
+		"quay.io":   {PasswordSecret: "QUAY_TOKEN"},
+	}
+
+	// registries without credentials fall back to the platform's own
+	step, err := registryLoginStep("ghcr.io", registries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if step.Registry.PasswordSecret != "" || len(step.Secrets) != 0 {
+		t.Errorf("expected no credentials for ghcr.io, got %+v", step)
+	}
+
+	step, err = registryLoginStep("docker.io", registries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if step.Registry.Username != "example" || step.Secrets["DOCKERHUB_TOKEN"] != "DOCKERHUB_TOKEN" {
+		t.Errorf("expected configured credentials for docker.io, got %+v", step)
+	}
+
+	_, err = registryLoginStep("quay.io", registries)
+	if err == nil {
+		t.Error("expected an error for a registry without a username")
+	}
+}
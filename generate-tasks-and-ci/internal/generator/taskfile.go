@@ -1,22 +1,24 @@
-package main
+package generator
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"log/slog"
 	"os"
 	"path"
 	"regexp"
 	"slices"
 	"strings"
 
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
 	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/lanuages"
 	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/util"
 	"gopkg.in/yaml.v3"
 )
 
-func updateTaskfile(projectPath string) {
+func generateTaskfile(ctx context.Context, projectPath string, cfg config.Config, settings lanuages.Settings) (*task.TaskFile, []File, error) {
 	// output skeleton - this will be mutated by each language to add tasks
 	taskFile := task.TaskFile{
 		Version: "3",
@@ -29,6 +31,12 @@ func updateTaskfile(projectPath string) {
 		Tasks: map[string]*task.Task{},
 	}
 
+	// index the project once, then share it between all finders
+	index, err := util.NewFileIndex(projectPath, cfg.Ignore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error indexing project: %w", err)
+	}
+
 	// collect projects and generate layer-3 tasks
 	allProjects := []lanuages.Project{}
 	projectFinders := []lanuages.ProjectFinder{
@@ -41,28 +49,43 @@ func updateTaskfile(projectPath string) {
 	}
 
 	for _, finder := range projectFinders {
-		projects, err := finder(projectPath)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		projects, err := finder(index, settings)
 		if err != nil {
-			slog.Error("error finding projects", "error", err)
-			os.Exit(1)
+			return nil, nil, fmt.Errorf("error finding projects: %w", err)
 		}
 		allProjects = append(allProjects, projects...)
 	}
 
+	gitignores := map[string]string{}
+	gitignorePaths := []string{}
 	for _, p := range allProjects {
-		err := updateGitignore(p.GetProjectPath())
-		if err != nil {
-			slog.Error("error updating .gitignore", "error", err)
-			os.Exit(1)
+		if isProjectSkipped(cfg, p.GetRelativePath()) {
+			continue
 		}
 
-		err = p.AddTasks(&taskFile)
+		gitignorePath := path.Join(p.GetRelativePath(), ".gitignore")
+		contents, ok := gitignores[gitignorePath]
+		if !ok {
+			contents, err = readGitignore(path.Join(projectPath, gitignorePath))
+			if err != nil {
+				return nil, nil, err
+			}
+			gitignorePaths = append(gitignorePaths, gitignorePath)
+		}
+		gitignores[gitignorePath] = updateGitignore(contents)
+
+		err := p.AddTasks(&taskFile)
 		if err != nil {
-			slog.Error("error adding tasks", "error", err)
-			os.Exit(1)
+			return nil, nil, fmt.Errorf("error adding tasks: %w", err)
 		}
 	}
 
+	applyProjectConfig(&taskFile, cfg)
+
 	// collect names of layer-3 tasks that will be exposed
 	layer3Names := []string{}
 	for name, task := range taskFile.Tasks {
@@ -76,18 +99,18 @@ func updateTaskfile(projectPath string) {
 
 	// generate layer-1 and layer-2 tasks
 	for _, name := range layer3Names {
-		nameChunks := strings.Split(name, "-")
+		id := taskFile.Tasks[name].ID
 
 		// all tasks have a layer-1 parent
-		layer1Name := nameChunks[0]
+		layer1Name := id.Type
 		if _, ok := taskFile.Tasks[layer1Name]; !ok {
 			taskFile.Tasks[layer1Name] = &task.Task{}
 		}
 		taskFile.Tasks[layer1Name].Commands = append(taskFile.Tasks[layer1Name].Commands, task.Command{Task: name})
 
 		// not all tasks have layer-2 parent
-		if len(nameChunks) > 2 {
-			layer2Name := fmt.Sprintf("%s-%s", nameChunks[0], nameChunks[1])
+		if id.Language != "" {
+			layer2Name := fmt.Sprintf("%s-%s", id.Type, id.Project)
 			if _, ok := taskFile.Tasks[layer2Name]; !ok {
 				taskFile.Tasks[layer2Name] = &task.Task{}
 			}
@@ -116,53 +139,40 @@ func updateTaskfile(projectPath string) {
 		}
 	}
 
-	// write output
+	gitignoreFiles := make([]File, len(gitignorePaths))
+	for i, p := range gitignorePaths {
+		gitignoreFiles[i] = File{Path: p, Contents: []byte(gitignores[p])}
+	}
 
+	return &taskFile, gitignoreFiles, nil
+}
+
+func encodeTaskfile(taskFile *task.TaskFile) ([]byte, error) {
 	var outputBuffer bytes.Buffer
+	outputBuffer.WriteString(generatedFileHeader + "\n\n")
+
 	encoder := yaml.NewEncoder(&outputBuffer)
 	encoder.SetIndent(2)
 	err := encoder.Encode(taskFile)
 	if err != nil {
-		slog.Error("Couldn't marshall output")
-		os.Exit(1)
+		return nil, fmt.Errorf("error encoding taskfile: %w", err)
 	}
 
-	handleWriteError := func(err error) {
-		if err != nil {
-			slog.Error("Error writing to taskfile", "error", err)
-			os.Exit(1)
-		}
-	}
-
-	outputPath := path.Join(projectPath, "taskfile.yml")
-	outputFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	handleWriteError(err)
-	defer func() {
-		_ = outputFile.Close()
-	}()
-
-	_, err = outputFile.WriteString("# This file is maintained by Tedium - manual edits will be overwritten!\n\n")
-	handleWriteError(err)
-
-	_, err = outputFile.Write(outputBuffer.Bytes())
-	handleWriteError(err)
+	return outputBuffer.Bytes(), nil
 }
 
-func updateGitignore(projectPath string) error {
-	gitignorePath := path.Join(projectPath, ".gitignore")
-	_, statErr := os.Stat(gitignorePath)
-
-	var contents string
-	if errors.Is(statErr, os.ErrNotExist) {
-		contents = ""
-	} else {
-		contentsRaw, err := os.ReadFile(gitignorePath)
-		if err != nil {
-			return fmt.Errorf("error reading gitignore: %w", err)
-		}
-		contents = string(contentsRaw)
+func readGitignore(gitignorePath string) (string, error) {
+	contents, err := os.ReadFile(gitignorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error reading gitignore: %w", err)
 	}
 
+	return string(contents), nil
+}
+
+func updateGitignore(contents string) string {
 	lines := strings.Split(contents, "\n")
 	replaced := false
 	seen := false
@@ -183,11 +193,5 @@ func updateGitignore(projectPath string) error {
 		lines = append(lines, ".task-meta-*")
 	}
 
-	contents = strings.Join(lines, "\n")
-	err := os.WriteFile(gitignorePath, []byte(contents), 0644)
-	if err != nil {
-		return fmt.Errorf("error writing gitignore: %w", err)
-	}
-
-	return nil
+	return strings.Join(lines, "\n")
 }
@@ -0,0 +1,4 @@
+package converter
+
+// goverter:converter
+type Converter interface{}
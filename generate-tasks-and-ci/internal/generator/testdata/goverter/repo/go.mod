@@ -0,0 +1,5 @@
+module example.com/app
+
+go 1.26.0
+
+tool github.com/jmattheis/goverter/cmd/goverter
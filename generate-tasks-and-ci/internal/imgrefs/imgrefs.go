@@ -0,0 +1,144 @@
+// Package imgrefs generates the script that computes the tags for a container image, based on the state of the git repo it was built from.
+package imgrefs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Strategy is one way of deriving image tags from a build.
+type Strategy string
+
+const (
+	// StrategyVersion tags with the output of git describe, such as v1.2.3 or v1.2.3-4-gabcdef0.
+	StrategyVersion Strategy = "version"
+	// StrategyMajor tags an exact release with its major version (v1) if it's the newest release within that major.
+	StrategyMajor Strategy = "major"
+	// StrategyMinor tags an exact release with its major and minor version (v1.2) if it's the newest release within that minor.
+	StrategyMinor Strategy = "minor"
+	// StrategyLatest tags an exact release as "latest" if it's the newest release overall.
+	StrategyLatest Strategy = "latest"
+	// StrategySHA tags with the short commit SHA (sha-abcdef0).
+	StrategySHA Strategy = "sha"
+	// StrategyBranch tags with the checked-out branch name, made safe for use as a tag.
+	StrategyBranch Strategy = "branch"
+	// StrategyDate tags with the commit date (20060102).
+	StrategyDate Strategy = "date"
+)
+
+// Strategies are all known strategies, in the order their tags are written.
+var Strategies = []Strategy{StrategyVersion, StrategyMajor, StrategyMinor, StrategyLatest, StrategySHA, StrategyBranch, StrategyDate}
+
+// DefaultStrategies match the tags images have always been given.
+var DefaultStrategies = []Strategy{StrategyVersion, StrategyMajor, StrategyLatest}
+
+// ParseStrategies validates a list of strategy names. An empty list gives the defaults.
+func ParseStrategies(names []string) ([]Strategy, error) {
+	if len(names) == 0 {
+		return DefaultStrategies, nil
+	}
+
+	output := []Strategy{}
+	for _, name := range names {
+		s := Strategy(name)
+		if !slices.Contains(Strategies, s) {
+			return nil, fmt.Errorf("unknown image tag strategy '%s'", name)
+		}
+		if !slices.Contains(output, s) {
+			output = append(output, s)
+		}
+	}
+
+	return output, nil
+}
+
+// releasePattern matches semantic versions (optionally prefixed with "v") that aren't pre-releases. Leading zeros aren't allowed, so the
+// numbers are safe to compare in bash arithmetic.
+const releasePattern = `^(v?)(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`
+
+// scriptSteps are the bash snippets that add each strategy's tag.
+var scriptSteps = map[Strategy]string{
+	StrategyVersion: `add_tag "${describe}"`,
+	StrategyMajor: `if [[ "${is_release}" == "y" ]] && is_newest_release "${major}" ""; then
+  add_tag "${prefix}${major}"
+fi`,
+	StrategyMinor: `if [[ "${is_release}" == "y" ]] && is_newest_release "${major}" "${minor}"; then
+  add_tag "${prefix}${major}.${minor}"
+fi`,
+	StrategyLatest: `if [[ "${is_release}" == "y" ]] && is_newest_release "" ""; then
+  add_tag "latest"
+fi`,
+	StrategySHA: `if [[ ${#sha} -ge 7 ]]; then
+  add_tag "sha-${sha:0:7}"
+fi`,
+	StrategyBranch: `add_tag "$(echo -n "${branch}" | sed -E 's/[^a-zA-Z0-9_.-]+/-/g; s/^[.-]+//' | cut -c 1-128)"`,
+	StrategyDate:   `add_tag "${date}"`,
+}
+
+// Script returns bash that fills the tags array for the given strategies, without duplicates. It reads what's known about the commit from
+// the describe, exact_tag, sha, branch and date variables and every tag in the repo from all_tags (one per line), any of which may be empty.
+func Script(strategies []Strategy) string {
+	var sb strings.Builder
+
+	sb.WriteString(`
+tags=()
+
+add_tag() {
+  local tag
+  if [[ -z "$1" ]]; then
+    return
+  fi
+  for tag in ${tags[@]+"${tags[@]}"}; do
+    if [[ "${tag}" == "$1" ]]; then
+      return
+    fi
+  done
+  tags+=("$1")
+}
+`)
+
+	if slices.Contains(strategies, StrategyMajor) || slices.Contains(strategies, StrategyMinor) || slices.Contains(strategies, StrategyLatest) {
+		sb.WriteString(`
+# releases are exact tags that parse as semver and aren't pre-releases
+release_pattern='` + releasePattern + `'
+
+is_release=n
+if [[ "${exact_tag}" =~ ${release_pattern} ]]; then
+  is_release=y
+  prefix=${BASH_REMATCH[1]}
+  major=${BASH_REMATCH[2]}
+  minor=${BASH_REMATCH[3]}
+  patch=${BASH_REMATCH[4]}
+fi
+
+# is_newest_release <major> <minor> checks that no release within the given major and minor (or overall, if empty) is newer than the exact tag
+is_newest_release() {
+  local tag t_major t_minor t_patch
+  while read -r tag; do
+    if ! [[ "${tag}" =~ ${release_pattern} ]]; then
+      continue
+    fi
+    t_major=${BASH_REMATCH[2]}
+    t_minor=${BASH_REMATCH[3]}
+    t_patch=${BASH_REMATCH[4]}
+    if [[ -n "$1" && "${t_major}" != "$1" ]] || [[ -n "$2" && "${t_minor}" != "$2" ]]; then
+      continue
+    fi
+    if ((t_major > major || (t_major == major && (t_minor > minor || (t_minor == minor && t_patch > patch))))); then
+      return 1
+    fi
+  done <<<"${all_tags}"
+  return 0
+}
+`)
+	}
+
+	for _, s := range Strategies {
+		if slices.Contains(strategies, s) {
+			sb.WriteString("\n" + scriptSteps[s] + "\n")
+		}
+	}
+
+	return sb.String()
+}
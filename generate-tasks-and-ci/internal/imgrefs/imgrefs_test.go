@@ -0,0 +1,115 @@
+package imgrefs
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Facts are what's known about the commit an image is built from, as the imgrefs task reads them from git.
+type Facts struct {
+	Describe string
+	ExactTag string
+	Tags     []string
+	SHA      string
+	Branch   string
+	Date     string
+}
+
+// runScript runs the generated script for the facts and returns the tags it computed.
+func runScript(t *testing.T, facts Facts, strategies []Strategy) []string {
+	t.Helper()
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not available")
+	}
+
+	script := "set -euo pipefail\n" + Script(strategies) + `printf '%s\n' ${tags[@]+"${tags[@]}"}`
+	cmd := exec.Command(bash, "-c", script)
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"describe=" + facts.Describe,
+		"exact_tag=" + facts.ExactTag,
+		"all_tags=" + strings.Join(facts.Tags, "\n"),
+		"sha=" + facts.SHA,
+		"branch=" + facts.Branch,
+		"date=" + facts.Date,
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("error running script: %v", err)
+	}
+
+	return strings.Fields(string(output))
+}
+
+func TestTags(t *testing.T) {
+	tags := []string{"v1.9.0", "v1.10.0", "v1.10.1", "v2.0.0-rc.1", "v01.20.0", "not-a-version"}
+	all := Strategies
+
+	testCases := []struct {
+		name     string
+		facts    Facts
+		expected []string
+	}{
+		{
+			name:     "newest release",
+			facts:    Facts{Describe: "v1.10.1", ExactTag: "v1.10.1", Tags: tags, SHA: "abcdef0123456789", Branch: "main", Date: "20240102"},
+			expected: []string{"v1.10.1", "v1", "v1.10", "latest", "sha-abcdef0", "main", "20240102"},
+		},
+		{
+			// sort -V would put v1.9.0 after v1.10.0
+			name:     "older release",
+			facts:    Facts{Describe: "v1.9.0", ExactTag: "v1.9.0", Tags: tags},
+			expected: []string{"v1.9.0", "v1.9"},
+		},
+		{
+			name:     "pre-release",
+			facts:    Facts{Describe: "v2.0.0-rc.1", ExactTag: "v2.0.0-rc.1", Tags: tags},
+			expected: []string{"v2.0.0-rc.1"},
+		},
+		{
+			name:     "untagged commit",
+			facts:    Facts{Describe: "v1.10.1-3-gabcdef0", Tags: tags, SHA: "abcdef0123456789", Branch: "feature/Some thing"},
+			expected: []string{"v1.10.1-3-gabcdef0", "sha-abcdef0", "feature-Some-thing"},
+		},
+		{
+			name:     "no tags at all",
+			facts:    Facts{SHA: "abcdef0123456789"},
+			expected: []string{"sha-abcdef0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := runScript(t, tc.facts, all)
+			if !slices.Equal(output, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, output)
+			}
+		})
+	}
+
+	// the defaults match the original behaviour
+	output := runScript(t, testCases[0].facts, DefaultStrategies)
+	if expected := []string{"v1.10.1", "v1", "latest"}; !slices.Equal(output, expected) {
+		t.Errorf("expected %v from the default strategies, got %v", expected, output)
+	}
+}
+
+func TestParseStrategies(t *testing.T) {
+	strategies, err := ParseStrategies([]string{"sha", "version", "sha"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(strategies, []Strategy{StrategySHA, StrategyVersion}) {
+		t.Errorf("expected duplicates to be dropped, got %v", strategies)
+	}
+
+	if _, err := ParseStrategies([]string{"semver"}); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
@@ -1,7 +1,6 @@
 package lanuages
 
 import (
-	"fmt"
 	"path"
 	"regexp"
 
@@ -14,11 +13,10 @@ type BufProject struct {
 	RelativePath string
 }
 
-func FindBufProjects(projectPath string) ([]Project, error) {
+func FindBufProjects(index *util.FileIndex, _ Settings) ([]Project, error) {
 	output := []Project{}
 
-	bufGenPaths, err := util.Find(
-		projectPath,
+	bufGenPaths := index.Find(
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/)buf\.gen\.ya?ml`),
@@ -27,13 +25,10 @@ func FindBufProjects(projectPath string) ([]Project, error) {
 			regexp.MustCompile(`(^|/)\.git/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for Buf projects: %w", err)
-	}
 
 	for _, p := range bufGenPaths {
 		output = append(output, &BufProject{
-			ProjectPath:  path.Join(projectPath, path.Dir(p)),
+			ProjectPath:  path.Join(index.Root, path.Dir(p)),
 			RelativePath: path.Dir(p),
 		})
 	}
@@ -66,39 +61,34 @@ func (p *BufProject) GetRelativePath() string {
 	return p.RelativePath
 }
 
+func (p *BufProject) taskID(taskType string) task.ID {
+	return task.ID{Type: taskType, Project: util.PathToSafeName(p.RelativePath), Language: "buf"}
+}
+
 func (p *BufProject) addLintTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("lint-%s-buf", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("lint"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `buf format --diff --exit-code`},
 			{Command: `buf lint`},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *BufProject) addLintFixTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("lintfix-%s-buf", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("lintfix"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `buf format --write`},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *BufProject) addGenTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("gen-%s-buf", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("gen"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `buf generate`},
 		},
-	}
-
-	return nil
+	})
 }
@@ -1,16 +1,72 @@
 package lanuages
 
-func cacheLoadCommand() string {
-	return `
+import (
+	"fmt"
+	"strings"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/imgrefs"
+)
+
+// Settings are the repo-wide choices that affect the tasks generated for every project.
+type Settings struct {
+	Cache CacheBackend
+
+	// ImageTags are the strategies the imgrefs tasks use to tag images.
+	ImageTags []imgrefs.Strategy
+
+	// ImageScan enables the imgscan tasks. Nil means images aren't scanned.
+	ImageScan *ImageScanner
+}
+
+// CacheBackend stores and restores dependency caches for the cacheload and cachesave tasks.
+//
+// Every backend works from two files written by per-project tasks: .task-meta-cache-key, holding the key (only written in CI), and
+// .task-meta-cache-paths, holding a space-separated list of paths to cache.
+type CacheBackend interface {
+	// LoadCommand restores the cache, touching .task-meta-cache-exact-match if the key matched exactly. Empty if the backend has no load task.
+	LoadCommand() string
+
+	// SaveCommand stores the cache, unless an exact match was loaded. Empty if the backend has no save task.
+	SaveCommand() string
+
+	// Secrets are the environment variables that the commands read from CI secrets.
+	Secrets() []string
+}
+
+// ServerCache is the bespoke cache server, which falls back to the closest key when there is no exact match.
+type ServerCache struct {
+	URL string
+}
+
+// S3Cache stores caches as objects in an S3-compatible bucket, with credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type S3Cache struct {
+	Endpoint string
+	Bucket   string
+	Region   string
+}
+
+// LocalCache stores caches in a directory on the runner, which must persist between jobs.
+type LocalCache struct {
+	Dir string
+}
+
+// NativeCache leaves caching to the CI platform (e.g. actions/cache), so no load or save tasks are generated.
+type NativeCache struct{}
+
+// NoCache disables caching.
+type NoCache struct{}
+
+func (c ServerCache) LoadCommand() string {
+	return fmt.Sprintf(`
 if [[ -n "${CI_CACHE_TOKEN:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
   request_key=$(cat ".task-meta-cache-key" | tr -d '\r\n')
-  start_ts=$(date +%s)
+  start_ts=$(date +%%s)
   header_file=$(mktemp)
   cache_file=$(mktemp)
 
   echo "loading cache..."
   echo "request key: ${request_key}"
-  if curl -fsSL -D "${header_file}" -H "authorization: Bearer ${CI_CACHE_TOKEN}" "https://ci-cache.markormesher.co.uk/cache/${request_key}" -o "${cache_file}"; then
+  if curl -fsSL -D "${header_file}" -H "authorization: Bearer ${CI_CACHE_TOKEN}" "%s/cache/${request_key}" -o "${cache_file}"; then
     actual_key=$(cat "${header_file}" | grep -i x-cache-key | cut -d ' ' -f 2 | tr -d '\r\n')
     size=$(du -h "${cache_file}" | awk '{ print $1 }')
     echo "received key: ${actual_key}"
@@ -27,14 +83,14 @@ if [[ -n "${CI_CACHE_TOKEN:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
   fi
 
   rm -f "${cache_file}" "${header_file}"
-  end_ts=$(date +%s)
+  end_ts=$(date +%%s)
   echo "loading cache took $(( $end_ts - $start_ts ))s"
 fi
-`
+`, strings.TrimRight(c.URL, "/"))
 }
 
-func cacheSaveCommand() string {
-	return `
+func (c ServerCache) SaveCommand() string {
+	return fmt.Sprintf(`
 if [[ -n "${CI_CACHE_TOKEN:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
   if [[ -f .task-meta-cache-exact-match ]]; then
     echo "skipping re-upload because an exact match was returned from the cache"
@@ -42,7 +98,7 @@ if [[ -n "${CI_CACHE_TOKEN:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
   fi
 
   request_key=$(cat ".task-meta-cache-key")
-  start_ts=$(date +%s)
+  start_ts=$(date +%%s)
   cache_file=$(mktemp)
 
   echo "packing cache..."
@@ -50,15 +106,126 @@ if [[ -n "${CI_CACHE_TOKEN:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
   size=$(du -h "${cache_file}" | awk '{ print $1 }')
 
   echo "uploading cache (${size})..."
-  if curl -fsSL -H "authorization: Bearer ${CI_CACHE_TOKEN}" -X PUT "https://ci-cache.markormesher.co.uk/cache/${request_key}" --data-binary "@${cache_file}"; then
+  if curl -fsSL -H "authorization: Bearer ${CI_CACHE_TOKEN}" -X PUT "%s/cache/${request_key}" --data-binary "@${cache_file}"; then
     echo "uploaded cache"
   else
     echo "error saving cache"
   fi
 
   rm -f "${cache_file}"
-  end_ts=$(date +%s)
+  end_ts=$(date +%%s)
   echo "saving cache took $(( $end_ts - $start_ts ))s"
 fi
-`
+`, strings.TrimRight(c.URL, "/"))
+}
+
+func (c ServerCache) Secrets() []string {
+	return []string{"CI_CACHE_TOKEN"}
+}
+
+func (c S3Cache) objectURL() string {
+	return fmt.Sprintf("%s/%s/${request_key}.tar.gz", strings.TrimRight(c.Endpoint, "/"), c.Bucket)
+}
+
+func (c S3Cache) LoadCommand() string {
+	return fmt.Sprintf(`
+if [[ -n "${AWS_ACCESS_KEY_ID:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
+  request_key=$(cat ".task-meta-cache-key" | tr -d '\r\n')
+  cache_file=$(mktemp)
+
+  echo "loading cache..."
+  echo "request key: ${request_key}"
+  if curl -fsSL --aws-sigv4 "aws:amz:%s:s3" --user "${AWS_ACCESS_KEY_ID}:${AWS_SECRET_ACCESS_KEY}" "%s" -o "${cache_file}"; then
+    # objects are only ever fetched by their exact key
+    touch .task-meta-cache-exact-match
+
+    echo "unpacking cache..."
+    tar xzP -f "${cache_file}" || true
+  else
+    echo "no cache loaded"
+  fi
+
+  rm -f "${cache_file}"
+fi
+`, c.Region, c.objectURL())
+}
+
+func (c S3Cache) SaveCommand() string {
+	return fmt.Sprintf(`
+if [[ -n "${AWS_ACCESS_KEY_ID:-}" ]] && [[ -f ".task-meta-cache-key" ]]; then
+  if [[ -f .task-meta-cache-exact-match ]]; then
+    echo "skipping re-upload because an exact match was returned from the cache"
+    exit 0
+  fi
+
+  request_key=$(cat ".task-meta-cache-key" | tr -d '\r\n')
+  cache_file=$(mktemp)
+
+  echo "packing cache..."
+  tar czP -f "${cache_file}" $(cat .task-meta-cache-paths)
+
+  echo "uploading cache..."
+  if curl -fsSL --aws-sigv4 "aws:amz:%s:s3" --user "${AWS_ACCESS_KEY_ID}:${AWS_SECRET_ACCESS_KEY}" -T "${cache_file}" "%s"; then
+    echo "uploaded cache"
+  else
+    echo "error saving cache"
+  fi
+
+  rm -f "${cache_file}"
+fi
+`, c.Region, c.objectURL())
+}
+
+func (c S3Cache) Secrets() []string {
+	return []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}
 }
+
+func (c LocalCache) LoadCommand() string {
+	return fmt.Sprintf(`
+if [[ -f ".task-meta-cache-key" ]]; then
+  request_key=$(cat ".task-meta-cache-key" | tr -d '\r\n')
+  cache_file="%s/${request_key}.tar.gz"
+
+  echo "request key: ${request_key}"
+  if [[ -f "${cache_file}" ]]; then
+    touch .task-meta-cache-exact-match
+
+    echo "unpacking cache..."
+    tar xzP -f "${cache_file}" || true
+  else
+    echo "no cache loaded"
+  fi
+fi
+`, strings.TrimRight(c.Dir, "/"))
+}
+
+func (c LocalCache) SaveCommand() string {
+	return fmt.Sprintf(`
+if [[ -f ".task-meta-cache-key" ]]; then
+  if [[ -f .task-meta-cache-exact-match ]]; then
+    echo "skipping save because an exact match was loaded from the cache"
+    exit 0
+  fi
+
+  request_key=$(cat ".task-meta-cache-key" | tr -d '\r\n')
+  cache_file="%s/${request_key}.tar.gz"
+
+  # write to a temp file first so that concurrent jobs never see a partial archive
+  echo "packing cache..."
+  mkdir -p "$(dirname "${cache_file}")"
+  tar czP -f "${cache_file}.tmp.$$" $(cat .task-meta-cache-paths) && mv "${cache_file}.tmp.$$" "${cache_file}"
+fi
+`, strings.TrimRight(c.Dir, "/"))
+}
+
+func (c LocalCache) Secrets() []string {
+	return nil
+}
+
+func (NativeCache) LoadCommand() string { return "" }
+func (NativeCache) SaveCommand() string { return "" }
+func (NativeCache) Secrets() []string   { return nil }
+
+func (NoCache) LoadCommand() string { return "" }
+func (NoCache) SaveCommand() string { return "" }
+func (NoCache) Secrets() []string   { return nil }
@@ -0,0 +1,176 @@
+package lanuages
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testCacheKey = "project-go-v1/deps/lock"
+
+func TestCacheBackends(t *testing.T) {
+	for _, tool := range []string{"bash", "curl", "tar"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+
+	t.Run("server", func(t *testing.T) {
+		store := newTestObjectStore(t, func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer test-token"
+		})
+
+		server := httptest.NewServer(http.StripPrefix("/cache/", store))
+		defer server.Close()
+
+		testCacheRoundTrip(t, ServerCache{URL: server.URL + "/"}, []string{"CI_CACHE_TOKEN=test-token"})
+
+		if _, ok := store.get(testCacheKey); !ok {
+			t.Error("expected the cache to be stored under its key")
+		}
+	})
+
+	t.Run("s3", func(t *testing.T) {
+		store := newTestObjectStore(t, func(r *http.Request) bool {
+			return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-id/")
+		})
+
+		server := httptest.NewServer(http.StripPrefix("/ci-cache/", store))
+		defer server.Close()
+
+		testCacheRoundTrip(t, S3Cache{Endpoint: server.URL, Bucket: "ci-cache", Region: "eu-west-1"}, []string{"AWS_ACCESS_KEY_ID=test-id", "AWS_SECRET_ACCESS_KEY=test-secret"})
+
+		if _, ok := store.get(testCacheKey + ".tar.gz"); !ok {
+			t.Error("expected the cache to be stored as an object named after its key")
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		dir := t.TempDir()
+
+		testCacheRoundTrip(t, LocalCache{Dir: dir}, nil)
+
+		if _, err := os.Stat(path.Join(dir, testCacheKey+".tar.gz")); err != nil {
+			t.Errorf("expected the cache to be stored in the directory: %v", err)
+		}
+	})
+}
+
+// testCacheRoundTrip saves a cached directory, deletes it, then checks that loading the cache restores it.
+func testCacheRoundTrip(t *testing.T, cache CacheBackend, env []string) {
+	t.Helper()
+
+	workDir := t.TempDir()
+	cachedDir := path.Join(t.TempDir(), "cached")
+	writeTestFile(t, path.Join(cachedDir, "module.txt"), "cached contents")
+	writeTestFile(t, path.Join(workDir, ".task-meta-cache-key"), testCacheKey+"\n")
+	writeTestFile(t, path.Join(workDir, ".task-meta-cache-paths"), cachedDir+"\n")
+
+	runCacheCommand(t, workDir, cache.SaveCommand(), env)
+
+	err := os.RemoveAll(cachedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCacheCommand(t, workDir, cache.LoadCommand(), env)
+
+	contents, err := os.ReadFile(path.Join(cachedDir, "module.txt"))
+	if err != nil {
+		t.Fatalf("expected the cached directory to be restored: %v", err)
+	}
+	if string(contents) != "cached contents" {
+		t.Errorf("unexpected restored contents: %q", contents)
+	}
+
+	if _, err := os.Stat(path.Join(workDir, ".task-meta-cache-exact-match")); err != nil {
+		t.Error("expected an exact match to be recorded")
+	}
+}
+
+func runCacheCommand(t *testing.T, dir string, command string, env []string) {
+	t.Helper()
+
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("cache command failed: %v\n%s", err, output)
+	}
+}
+
+func writeTestFile(t *testing.T, filePath string, contents string) {
+	t.Helper()
+
+	err := os.MkdirAll(path.Dir(filePath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filePath, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testObjectStore is a minimal stand-in for the cache server and S3, storing PUT bodies and returning them on GET.
+type testObjectStore struct {
+	t          *testing.T
+	authorised func(r *http.Request) bool
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newTestObjectStore(t *testing.T, authorised func(r *http.Request) bool) *testObjectStore {
+	return &testObjectStore{t: t, authorised: authorised, objects: map[string][]byte{}}
+}
+
+func (s *testObjectStore) get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, ok := s.objects[key]
+	return body, ok
+}
+
+func (s *testObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(r) {
+		s.t.Errorf("unauthorised %s request to %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.mu.Lock()
+		s.objects[r.URL.Path] = body
+		s.mu.Unlock()
+
+	case http.MethodGet:
+		body, ok := s.get(r.URL.Path)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Cache-Key", r.URL.Path)
+		_, _ = w.Write(body)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -2,24 +2,37 @@ package lanuages
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"regexp"
+	"slices"
+	"strings"
 
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/imgrefs"
 	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
 	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/util"
 )
 
+// ImageSaveFile is where the imgsave tasks export an image, so that another CI job can load it instead of building it again.
+const ImageSaveFile = ".task-meta-imgsave.tar"
+
 type ContainerImageProject struct {
 	ProjectPath       string
 	RelativePath      string
 	ContainerFileName string
+	Registry          string
+	TagStrategies     []imgrefs.Strategy
+	Tests             *ContainerTests
+	// BuildArgs are the label build args that the container file declares, which are passed to builds.
+	BuildArgs []string
+	Scanner   *ImageScanner
+	Cache     CacheBackend
 }
 
-func FindContainerImageProjects(projectPath string) ([]Project, error) {
+func FindContainerImageProjects(index *util.FileIndex, settings Settings) ([]Project, error) {
 	output := []Project{}
 
-	imgManifestPaths, err := util.Find(
-		projectPath,
+	imgManifestPaths := index.Find(
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/)Dockerfile$`),
@@ -29,21 +42,104 @@ func FindContainerImageProjects(projectPath string) ([]Project, error) {
 			regexp.MustCompile(`(^|/)\.git/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for container image projects: %w", err)
-	}
 
 	for _, p := range imgManifestPaths {
+		registry, err := readImageLabel(path.Join(index.Root, p), "image.registry")
+		if err != nil {
+			return nil, err
+		}
+
+		tests, err := readContainerTests(path.Join(index.Root, p))
+		if err != nil {
+			return nil, err
+		}
+
+		buildArgs, err := readLabelBuildArgs(path.Join(index.Root, p))
+		if err != nil {
+			return nil, err
+		}
+
 		output = append(output, &ContainerImageProject{
-			ProjectPath:       path.Join(projectPath, path.Dir(p)),
+			ProjectPath:       path.Join(index.Root, path.Dir(p)),
 			RelativePath:      path.Dir(p),
 			ContainerFileName: path.Base(p),
+			Registry:          registry,
+			TagStrategies:     settings.ImageTags,
+			Tests:             tests,
+			BuildArgs:         buildArgs,
+			Scanner:           settings.ImageScan,
+			Cache:             settings.Cache,
 		})
 	}
 
 	return output, nil
 }
 
+// readImageLabel finds the value of a label in a container file the same way as the imgrefs task: the last "LABEL key=value" line wins.
+func readImageLabel(containerFilePath string, key string) (string, error) {
+	contents, err := os.ReadFile(containerFilePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", containerFilePath, err)
+	}
+
+	value := ""
+	prefix := "LABEL " + key + "="
+	for _, line := range strings.Split(string(contents), "\n") {
+		if _, v, ok := strings.Cut(line, prefix); ok {
+			value = strings.TrimSpace(v)
+		}
+	}
+
+	return value, nil
+}
+
+// labelBuildArgs are the build args that update-image-labels uses for the revision and created labels, with the commands that compute them.
+var labelBuildArgs = []struct {
+	Name    string
+	Command string
+}{
+	{"IMAGE_REVISION", "$(git rev-parse HEAD)"},
+	{"IMAGE_CREATED", "$(date -u +%Y-%m-%dT%H:%M:%SZ)"},
+}
+
+var argPattern = regexp.MustCompile(`(?im)^\s*ARG\s+([A-Za-z_][A-Za-z0-9_]*)`)
+
+func readLabelBuildArgs(containerFilePath string) ([]string, error) {
+	contents, err := os.ReadFile(containerFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", containerFilePath, err)
+	}
+
+	declared := map[string]bool{}
+	for _, m := range argPattern.FindAllStringSubmatch(string(contents), -1) {
+		declared[m[1]] = true
+	}
+
+	args := []string{}
+	for _, a := range labelBuildArgs {
+		if declared[a.Name] {
+			args = append(args, a.Name)
+		}
+	}
+
+	return args, nil
+}
+
+func (p *ContainerImageProject) buildArgOpts() string {
+	var sb strings.Builder
+	for _, a := range labelBuildArgs {
+		if slices.Contains(p.BuildArgs, a.Name) {
+			fmt.Fprintf(&sb, "\n  bud_opts+=(\"--build-arg\" \"%s=%s\")", a.Name, a.Command)
+		}
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+
+	return "\n  # label values that are only known at build time" + sb.String() + "\n"
+}
+
 func (p *ContainerImageProject) GetProjectPath() string {
 	return p.ProjectPath
 }
@@ -52,10 +148,17 @@ func (p *ContainerImageProject) GetRelativePath() string {
 	return p.RelativePath
 }
 
+func (p *ContainerImageProject) taskID(taskType string) task.ID {
+	return task.ID{Type: taskType, Project: util.PathToSafeName(p.RelativePath)}
+}
+
 func (p *ContainerImageProject) AddTasks(taskFile *task.TaskFile) error {
 	adders := []TaskAdder{
 		p.addRefsTask,
 		p.addBuildTask,
+		p.addTestTask,
+		p.addScanTask,
+		p.addSaveTask,
 		p.addPushTask,
 	}
 
@@ -84,9 +187,31 @@ fi
 `
 }
 
+func (p *ContainerImageProject) runnerSetup() string {
+	return `
+if ! command -v podman >/dev/null 2>&1; then
+  echo "Podman is not available" >&2
+  exit 1
+fi
+
+podman_opts=()
+
+if command -v fuse-overlayfs >/dev/null 2>&1; then
+  podman_opts+=("--storage-opt" "overlay.mount_program=$(command -v fuse-overlayfs)")
+fi
+`
+}
+
+func (p *ContainerImageProject) tagStrategies() []imgrefs.Strategy {
+	if len(p.TagStrategies) == 0 {
+		return imgrefs.DefaultStrategies
+	}
+
+	return p.TagStrategies
+}
+
 func (p *ContainerImageProject) addRefsTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("imgrefs-%s", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("imgrefs"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `
@@ -102,11 +227,6 @@ if ! command -v git >/dev/null 2>&1; then
   exit 1
 fi
 
-if ! git describe --tags >/dev/null 2>&1; then
-  echo "No git tags to descibe" >&2
-  exit 1
-fi
-
 if ! grep ".task-meta-*" .gitignore >/dev/null 2>&1; then
   echo ".gitignore must include .task-meta-* to use the image builder tasks" >&2
   exit 1
@@ -115,28 +235,25 @@ fi
 img_name=$( (grep "LABEL image.name=" ` + p.ContainerFileName + ` || echo) | tail -n 1 | cut -d '=' -f 2-)
 img_registry=$( (grep "LABEL image.registry=" ` + p.ContainerFileName + ` || echo) | tail -n 1 | cut -d '=' -f 2-)
 
-version=$(git describe --tags)
-is_exact_tag=$(git describe --tags --exact-match >/dev/null 2>&1 && echo y || echo n)
-major_version=$(echo "${version}" | cut -d '.' -f 1)
-latest_version_overall=$(git tag -l | sort -V | tail -n 1)
-latest_version_within_major=$(git tag -l | grep "^${major_version}" | sort -V | tail -n 1)
-
-echo -n "" > .task-meta-imgrefs
-
-if [[ ! -z "$img_name" ]]; then
-  echo "localhost/${img_name}" >> .task-meta-imgrefs
-  echo "localhost/${img_name}:${version}" >> .task-meta-imgrefs
-
-  if [[ ! -z "$img_registry" ]] && [[ ${CI+y} == "y" ]]; then
-    echo "${img_registry}/${img_name}:${version}" >> .task-meta-imgrefs
-
-    if [[ "${is_exact_tag}" == "y" ]] && [[ "${version}" == "${latest_version_within_major}" ]]; then
-      echo "${img_registry}/${img_name}:${major_version}" >> .task-meta-imgrefs
-    fi
+describe=$(git describe --tags 2>/dev/null || :)
+exact_tag=$(git describe --tags --exact-match 2>/dev/null || :)
+all_tags=$(git tag -l)
+sha=$(git rev-parse HEAD 2>/dev/null || :)
+branch=$(git symbolic-ref --short -q HEAD || :)
+date=$(git show -s --format=%cd --date=format:%Y%m%d HEAD 2>/dev/null || :)
+` + imgrefs.Script(p.tagStrategies()) + `
+echo -n "" >.task-meta-imgrefs
+
+if [[ -n "${img_name}" ]]; then
+  echo "localhost/${img_name}" >>.task-meta-imgrefs
+  for tag in ${tags[@]+"${tags[@]}"}; do
+    echo "localhost/${img_name}:${tag}" >>.task-meta-imgrefs
+  done
 
-    if [[ "${is_exact_tag}" == "y" ]] && [[ "${version}" == "${latest_version_overall}" ]]; then
-      echo "${img_registry}/${img_name}:latest" >> .task-meta-imgrefs
-    fi
+  if [[ -n "${img_registry}" ]] && [[ ${CI+y} == "y" ]]; then
+    for tag in ${tags[@]+"${tags[@]}"}; do
+      echo "${img_registry}/${img_name}:${tag}" >>.task-meta-imgrefs
+    done
   fi
 else
   echo "Warning: no image name label; image will not be tagged" >&2
@@ -146,17 +263,14 @@ echo "Image refs:"
 cat .task-meta-imgrefs | grep "." || echo "None"
 `},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *ContainerImageProject) addBuildTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("imgbuild-%s", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("imgbuild"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Dependencies: []string{
-			fmt.Sprintf("imgrefs-%s", util.PathToSafeName(p.RelativePath)),
+			p.taskID("imgrefs").Name(),
 		},
 		Commands: []task.Command{
 			{Command: `
@@ -164,20 +278,34 @@ set -euo pipefail
 
 ` + p.builderSetup() + `
 
-bud_opts=(
-  --layers
-  -f "` + p.ContainerFileName + `"
-)
-
-if [[ -f argfile.conf ]]; then
-  bud_opts+=("--build-arg-file" "argfile.conf")
+# later tasks in the same CI job depend on this one, but needn't build again
+if [[ -f .task-meta-imgbuild ]] && [[ ${CI+y} == "y" ]] && buildah "${buildah_opts[@]}" inspect "$(cat .task-meta-imgbuild)" >/dev/null 2>&1; then
+  echo "Skipping re-building image"
+  exit 0
 fi
 
-# first build to get visible logs
-buildah "${buildah_opts[@]}" bud "${bud_opts[@]}"
+# a CI job that publishes an image loads the one exported by the job that built it, rather than building it again
+if [[ -f ` + ImageSaveFile + ` ]] && [[ ${CI+y} == "y" ]]; then
+  img=$(buildah "${buildah_opts[@]}" pull -q oci-archive:` + ImageSaveFile + `)
+  echo "Loaded image from ` + ImageSaveFile + `"
+else
+  bud_opts=(
+    --layers
+    -f "` + p.ContainerFileName + `"
+  )
 
-# Second (cached) build to get the image ID
-img=$(buildah "${buildah_opts[@]}" bud "${bud_opts[@]}" -q)
+  if [[ -f argfile.conf ]]; then
+    bud_opts+=("--build-arg-file" "argfile.conf")
+  fi
+` + p.buildArgOpts() + `
+  # first build to get visible logs
+  buildah "${buildah_opts[@]}" bud "${bud_opts[@]}"
+
+  # Second (cached) build to get the image ID
+  img=$(buildah "${buildah_opts[@]}" bud "${bud_opts[@]}" -q)
+fi
+
+echo "${img}" >.task-meta-imgbuild
 
 if [[ -f .task-meta-imgrefs ]]; then
   cat .task-meta-imgrefs | while read tag; do
@@ -187,18 +315,91 @@ if [[ -f .task-meta-imgrefs ]]; then
 fi
 `},
 		},
+	})
+}
+
+func (p *ContainerImageProject) addTestTask(taskFile *task.TaskFile) error {
+	if p.Tests == nil {
+		return nil
 	}
 
-	return nil
+	return taskFile.AddTask(p.taskID("imgtest"), p.RelativePath, &task.Task{
+		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
+		Dependencies: []string{
+			p.taskID("imgbuild").Name(),
+		},
+		Commands: []task.Command{
+			{Command: `
+set -euo pipefail
+
+` + p.runnerSetup() + `
+
+img=$( (grep "^localhost/" .task-meta-imgrefs || :) | head -n 1)
+if [[ -z "${img}" ]]; then
+  echo "No local image ref to test - is there an image.name label?" >&2
+  exit 1
+fi
+
+failed=0
+` + p.Tests.command() + `
+exit ${failed}
+`},
+		},
+	})
 }
 
-func (p *ContainerImageProject) addPushTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("imgpush-%s", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+func (p *ContainerImageProject) addScanTask(taskFile *task.TaskFile) error {
+	if p.Scanner == nil {
+		return nil
+	}
+
+	return taskFile.AddTask(p.taskID("imgscan"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Dependencies: []string{
-			fmt.Sprintf("imgrefs-%s", util.PathToSafeName(p.RelativePath)),
+			p.taskID("imgbuild").Name(),
+		},
+		Commands: []task.Command{
+			{Command: `
+set -euo pipefail
+
+` + p.builderSetup() + p.Scanner.command(p.Cache)},
+		},
+		Artifacts: []task.Artifact{
+			{Name: "imgscan", Kind: task.ArtifactLintReport, Paths: []string{path.Join(ImageScanDir, "report.sarif")}},
+		},
+	})
+}
+
+func (p *ContainerImageProject) addSaveTask(taskFile *task.TaskFile) error {
+	return taskFile.AddTask(p.taskID("imgsave"), p.RelativePath, &task.Task{
+		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
+		Dependencies: []string{
+			p.taskID("imgbuild").Name(),
+		},
+		Commands: []task.Command{
+			{Command: `
+set -euo pipefail
+
+` + p.builderSetup() + `
+
+rm -f ` + ImageSaveFile + `
+buildah "${buildah_opts[@]}" push "$(cat .task-meta-imgbuild)" oci-archive:` + ImageSaveFile + `
+echo "Saved image to ` + ImageSaveFile + `"
+`},
 		},
+	})
+}
+
+func (p *ContainerImageProject) addPushTask(taskFile *task.TaskFile) error {
+	// the image is built before it's pushed, and scanning (which also builds it) blocks pushing, as it does in CI
+	dependencies := []string{p.taskID("imgbuild").Name()}
+	if p.Scanner != nil {
+		dependencies = []string{p.taskID("imgscan").Name()}
+	}
+
+	return taskFile.AddTask(p.taskID("imgpush"), p.RelativePath, &task.Task{
+		Directory:    path.Join("{{.ROOT_DIR}}", p.RelativePath),
+		Dependencies: dependencies,
 		Commands: []task.Command{
 			{Command: `
 set -euo pipefail
@@ -216,7 +417,6 @@ else
 fi
 `},
 		},
-	}
-
-	return nil
+		Registry: p.Registry,
+	})
 }
@@ -0,0 +1,182 @@
+package lanuages
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+)
+
+// ImageScanDir holds the scanner's working files within an image project: the exported image, the report and the vulnerability database.
+const ImageScanDir = ".task-meta-imgscan"
+
+// ScanSeverities are the severity thresholds that can fail a scan, from lowest to highest.
+var ScanSeverities = []string{"low", "medium", "high", "critical"}
+
+// ImageScanner configures the imgscan tasks, which fail if an image has vulnerabilities at or above Severity.
+type ImageScanner struct {
+	// Scanner is "trivy" or "grype".
+	Scanner  string
+	Severity string
+	// IgnoreFile is relative to the project: a .trivyignore file for Trivy or a config file with ignore rules for Grype.
+	IgnoreFile string
+	// DBDir is a pre-populated database to scan with offline. Empty means the database is downloaded into ImageScanDir and cached.
+	DBDir string
+}
+
+// scannerVersions pin the scanners that are installed on CI runners that don't already have them.
+var scannerVersions = map[string]string{
+	"trivy": "v0.58.1",
+	"grype": "v0.86.1",
+}
+
+// scannerInstallScripts are the scanners' own install scripts, which verify the checksums of what they download.
+var scannerInstallScripts = map[string]string{
+	"trivy": "https://raw.githubusercontent.com/aquasecurity/trivy/%s/contrib/install.sh",
+	"grype": "https://raw.githubusercontent.com/anchore/grype/%s/install.sh",
+}
+
+// NewImageScanner applies defaults to the scan config and validates it. It returns nil if scanning isn't enabled.
+func NewImageScanner(cfg config.ScanConfig) (*ImageScanner, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	scanner := ImageScanner{Scanner: cfg.Scanner, Severity: cfg.Severity, IgnoreFile: cfg.IgnoreFile, DBDir: cfg.DBDir}
+
+	switch scanner.Scanner {
+	case "":
+		scanner.Scanner = "trivy"
+	case "trivy", "grype":
+	default:
+		return nil, fmt.Errorf("unsupported image scanner '%s'", cfg.Scanner)
+	}
+
+	if scanner.Severity == "" {
+		scanner.Severity = "high"
+	}
+	if !slices.Contains(ScanSeverities, scanner.Severity) {
+		return nil, fmt.Errorf("unsupported scan severity '%s'", cfg.Severity)
+	}
+
+	return &scanner, nil
+}
+
+// dbDir is relative to ImageScanDir, because that's where the scan runs from.
+func (s ImageScanner) dbDir() string {
+	if s.DBDir == "" {
+		return "db"
+	}
+
+	if strings.HasPrefix(s.DBDir, "/") {
+		return s.DBDir
+	}
+
+	return "../" + s.DBDir
+}
+
+// CacheKeyCommand writes the cache key for the database, which is per repo like other cache keys, and changes daily so that it's refreshed
+// with new vulnerabilities.
+func (s ImageScanner) CacheKeyCommand() string {
+	return fmt.Sprintf(
+		`echo "$(echo "${FORGEJO_REPOSITORY:-${GITHUB_REPOSITORY:-${CI_PROJECT_PATH:-${CI_REPO:-noproject}}}}" | tr '[:upper:]' '[:lower:]' | tr -dc 'a-z0-9')-imgscan-%s-db/$(date -u +%%Y%%m%%d)"`,
+		s.Scanner,
+	)
+}
+
+func (s ImageScanner) command(cache CacheBackend) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, `
+# CI runners are given the scanner if they don't already have it
+if ! command -v %[1]s >/dev/null 2>&1 && [[ ${CI+y} == "y" ]]; then
+  mkdir -p %[2]s/bin
+  curl -sSfL %[3]s | sh -s -- -b %[2]s/bin %[4]s
+  export PATH="${PWD}/%[2]s/bin:${PATH}"
+fi
+
+if ! command -v %[1]s >/dev/null 2>&1; then
+  echo "Cannot find %[1]s" >&2
+  exit 1
+fi
+
+img=$( (grep "^localhost/" .task-meta-imgrefs || :) | head -n 1)
+if [[ -z "${img}" ]]; then
+  echo "No local image ref to scan - is there an image.name label?" >&2
+  exit 1
+fi
+
+mkdir -p %[2]s
+rm -f %[2]s/image.tar
+buildah "${buildah_opts[@]}" push "${img}" oci-archive:%[2]s/image.tar
+
+cd %[2]s
+`, s.Scanner, ImageScanDir, fmt.Sprintf(scannerInstallScripts[s.Scanner], scannerVersions[s.Scanner]), scannerVersions[s.Scanner])
+
+	offline := s.DBDir != ""
+	if !offline {
+		fmt.Fprintf(&sb, `
+if [[ ${CI+y} == "y" ]]; then
+  %s >.task-meta-cache-key
+fi
+echo "db" >.task-meta-cache-paths
+`, s.CacheKeyCommand())
+		sb.WriteString(subshell(cache.LoadCommand()))
+	}
+
+	// the scan's result is held back until the database has been saved
+	sb.WriteString("\nresult=0\n")
+
+	dbDir := shellQuote(s.dbDir())
+	switch s.Scanner {
+	case "trivy":
+		threshold := slices.Index(ScanSeverities, s.Severity)
+		severities := []string{}
+		for _, sev := range ScanSeverities[threshold:] {
+			severities = append(severities, strings.ToUpper(sev))
+		}
+
+		opts := fmt.Sprintf("--input image.tar --cache-dir %s", dbDir)
+		if s.IgnoreFile != "" {
+			opts += " --ignorefile " + shellQuote("../"+s.IgnoreFile)
+		}
+
+		// the first scan writes a report of everything, updating the database unless offline, then the second applies the policy
+		update := ""
+		if offline {
+			update = " --skip-db-update --skip-java-db-update --offline-scan"
+		}
+		fmt.Fprintf(&sb, "trivy image %s%s --format sarif --output report.sarif || result=$?\n", opts, update)
+		fmt.Fprintf(&sb, "trivy image %s --skip-db-update --skip-java-db-update --offline-scan --severity %s --exit-code 1 || result=$?\n", opts, strings.Join(severities, ","))
+
+	case "grype":
+		env := fmt.Sprintf("GRYPE_DB_CACHE_DIR=%s", dbDir)
+		if offline {
+			env += " GRYPE_DB_AUTO_UPDATE=false"
+		}
+		opts := ""
+		if s.IgnoreFile != "" {
+			opts = " -c " + shellQuote("../"+s.IgnoreFile)
+		}
+
+		fmt.Fprintf(&sb, "%s grype oci-archive:image.tar%s -o table -o sarif=report.sarif --fail-on %s || result=$?\n", env, opts, s.Severity)
+	}
+
+	if !offline {
+		sb.WriteString(subshell(cache.SaveCommand()))
+	}
+
+	sb.WriteString("\nexit ${result}\n")
+
+	return sb.String()
+}
+
+// subshell wraps a cache command, because they may exit early.
+func subshell(command string) string {
+	if command == "" {
+		return ""
+	}
+
+	return "\n(" + command + ")\n"
+}
@@ -0,0 +1,52 @@
+package lanuages
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/config"
+)
+
+func TestNewImageScanner(t *testing.T) {
+	scanner, err := NewImageScanner(config.ScanConfig{})
+	if err != nil || scanner != nil {
+		t.Errorf("expected no scanner when scanning is disabled, got %+v (%v)", scanner, err)
+	}
+
+	scanner, err = NewImageScanner(config.ScanConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (ImageScanner{Scanner: "trivy", Severity: "high"}); *scanner != expected {
+		t.Errorf("expected defaults %+v, got %+v", expected, *scanner)
+	}
+
+	for _, cfg := range []config.ScanConfig{
+		{Enabled: true, Scanner: "clair"},
+		{Enabled: true, Severity: "urgent"},
+	} {
+		if _, err := NewImageScanner(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestImageScannerCacheKey(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not available")
+	}
+
+	cmd := exec.Command(bash, "-c", ImageScanner{Scanner: "grype"}.CacheKeyCommand())
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "GITHUB_REPOSITORY=Someone/Some-Repo"}
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("error running command: %v", err)
+	}
+
+	if key := strings.TrimSpace(string(output)); !strings.HasPrefix(key, "someonesomerepo-imgscan-grype-db/") {
+		t.Errorf("expected the key to be specific to the repo and scanner, got '%s'", key)
+	}
+}
@@ -0,0 +1,164 @@
+package lanuages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContainerTestsFileName is read from next to a container file, in the style of container-structure-test.
+const ContainerTestsFileName = "container-test.yaml"
+
+// ContainerTests are the smoke tests run against a freshly built image by the imgtest task.
+type ContainerTests struct {
+	CommandTests       []ContainerCommandTest       `yaml:"commandTests,omitempty"`
+	FileExistenceTests []ContainerFileExistenceTest `yaml:"fileExistenceTests,omitempty"`
+	MetadataTest       ContainerMetadataTest        `yaml:"metadataTest,omitempty"`
+}
+
+// ContainerCommandTest runs the image and checks its exit code and output. Without a command, the args are passed to the image's own entrypoint.
+type ContainerCommandTest struct {
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty"`
+	// ExpectedOutput and ExcludedOutput are extended regexes that some line of the combined stdout and stderr must (or must not) match.
+	ExpectedOutput []string `yaml:"expectedOutput,omitempty"`
+	ExcludedOutput []string `yaml:"excludedOutput,omitempty"`
+	ExitCode       int      `yaml:"exitCode,omitempty"`
+}
+
+type ContainerFileExistenceTest struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// ShouldExist defaults to true.
+	ShouldExist *bool `yaml:"shouldExist,omitempty"`
+}
+
+type ContainerMetadataTest struct {
+	// ExposedPorts are ports the image must declare, e.g. "8080" or "53/udp".
+	ExposedPorts []string `yaml:"exposedPorts,omitempty"`
+}
+
+func (t ContainerTests) empty() bool {
+	return len(t.CommandTests) == 0 && len(t.FileExistenceTests) == 0 && len(t.MetadataTest.ExposedPorts) == 0
+}
+
+// readContainerTests collects the tests for a container file from its image.test label (args that the image must run successfully with) and
+// the tests file next to it. Nil means there are no tests.
+func readContainerTests(containerFilePath string) (*ContainerTests, error) {
+	tests := ContainerTests{}
+
+	testsPath := path.Join(path.Dir(containerFilePath), ContainerTestsFileName)
+	contents, err := os.ReadFile(testsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading %s: %w", testsPath, err)
+	}
+
+	if len(contents) > 0 {
+		decoder := yaml.NewDecoder(bytes.NewReader(contents))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&tests)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("error parsing %s: %w", testsPath, err)
+		}
+	}
+
+	label, err := readImageLabel(containerFilePath, "image.test")
+	if err != nil {
+		return nil, err
+	}
+
+	label = strings.Trim(label, `"`)
+	if label != "" {
+		tests.CommandTests = append([]ContainerCommandTest{{Name: "image.test label", Args: strings.Fields(label)}}, tests.CommandTests...)
+	}
+
+	for _, t := range tests.CommandTests {
+		if t.Name == "" {
+			return nil, fmt.Errorf("error parsing %s: command tests need a name", testsPath)
+		}
+	}
+
+	for _, t := range tests.FileExistenceTests {
+		if t.Name == "" || t.Path == "" {
+			return nil, fmt.Errorf("error parsing %s: file existence tests need a name and a path", testsPath)
+		}
+	}
+
+	if tests.empty() {
+		return nil, nil
+	}
+
+	return &tests, nil
+}
+
+// command writes the tests as a script that runs every test against $img, reporting each failure and setting $failed.
+func (t ContainerTests) command() string {
+	var sb strings.Builder
+
+	for _, c := range t.CommandTests {
+		run := []string{`podman "${podman_opts[@]}" run --rm`}
+		if c.Command != "" {
+			run = append(run, "--entrypoint", shellQuote(c.Command))
+		}
+		run = append(run, `"${img}"`)
+		for _, a := range c.Args {
+			run = append(run, shellQuote(a))
+		}
+
+		fmt.Fprintf(&sb, "\necho %s\n", shellQuote("Command test: "+c.Name))
+		fmt.Fprintf(&sb, "if output=$(%s 2>&1); then code=0; else code=$?; fi\n", strings.Join(run, " "))
+		sb.WriteString("test_failed=0\n")
+		fmt.Fprintf(&sb, "if [[ ${code} -ne %d ]]; then echo \"  expected exit code %d, got ${code}\"; test_failed=1; fi\n", c.ExitCode, c.ExitCode)
+		for _, e := range c.ExpectedOutput {
+			fmt.Fprintf(&sb, "if ! grep -qE -- %s <<<\"${output}\"; then echo %s; test_failed=1; fi\n", shellQuote(e), shellQuote("  expected output to match "+e))
+		}
+		for _, e := range c.ExcludedOutput {
+			fmt.Fprintf(&sb, "if grep -qE -- %s <<<\"${output}\"; then echo %s; test_failed=1; fi\n", shellQuote(e), shellQuote("  expected output not to match "+e))
+		}
+		sb.WriteString("if [[ ${test_failed} -ne 0 ]]; then echo \"${output}\"; failed=1; fi\n")
+	}
+
+	if len(t.FileExistenceTests) > 0 {
+		// copying out of a created container works even for images without a shell
+		sb.WriteString("\nctr=$(podman \"${podman_opts[@]}\" create \"${img}\")\n")
+		sb.WriteString("trap 'podman \"${podman_opts[@]}\" rm -f \"${ctr}\" >/dev/null' EXIT\n")
+
+		for _, f := range t.FileExistenceTests {
+			shouldExist := f.ShouldExist == nil || *f.ShouldExist
+			check := "! "
+			expectation := "  expected " + f.Path + " to exist"
+			if !shouldExist {
+				check = ""
+				expectation = "  expected " + f.Path + " not to exist"
+			}
+
+			fmt.Fprintf(&sb, "\necho %s\n", shellQuote("File existence test: "+f.Name))
+			fmt.Fprintf(&sb, "if %spodman \"${podman_opts[@]}\" cp \"${ctr}\":%s - >/dev/null 2>&1; then echo %s; failed=1; fi\n", check, shellQuote(f.Path), shellQuote(expectation))
+		}
+	}
+
+	if len(t.MetadataTest.ExposedPorts) > 0 {
+		sb.WriteString("\necho \"Metadata test\"\n")
+		sb.WriteString("metadata=$(podman \"${podman_opts[@]}\" image inspect \"${img}\")\n")
+		for _, port := range t.MetadataTest.ExposedPorts {
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			fmt.Fprintf(&sb, "if ! grep -qF %s <<<\"${metadata}\"; then echo %s; failed=1; fi\n", shellQuote(`"`+port+`"`), shellQuote("  expected port "+port+" to be exposed"))
+		}
+	}
+
+	return sb.String()
+}
+
+// shellQuote wraps a value in single quotes, so nothing in it is expanded.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -2,6 +2,7 @@ package lanuages
 
 import (
 	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/task"
+	"github.com/markormesher/tedium-chores/generate-tasks-and-ci/internal/util"
 )
 
 type Project interface {
@@ -12,4 +13,4 @@ type Project interface {
 
 type TaskAdder func(taskFile *task.TaskFile) error
 
-type ProjectFinder func(projectPath string) ([]Project, error)
+type ProjectFinder func(index *util.FileIndex, settings Settings) ([]Project, error)
@@ -1,7 +1,6 @@
 package lanuages
 
 import (
-	"fmt"
 	"path"
 	"regexp"
 
@@ -12,13 +11,14 @@ import (
 type GoProject struct {
 	ProjectPath  string
 	RelativePath string
+	HasTests     bool
+	Cache        CacheBackend
 }
 
-func FindGoProjects(projectPath string) ([]Project, error) {
+func FindGoProjects(index *util.FileIndex, settings Settings) ([]Project, error) {
 	output := []Project{}
 
-	goModPaths, err := util.Find(
-		projectPath,
+	goModPaths := index.Find(
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/)go\.mod`),
@@ -27,14 +27,22 @@ func FindGoProjects(projectPath string) ([]Project, error) {
 			regexp.MustCompile(`(^|/)\.git/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for Go projects: %w", err)
-	}
 
 	for _, p := range goModPaths {
+		testFiles := index.FindWithin(
+			path.Dir(p),
+			util.FIND_FILES,
+			[]*regexp.Regexp{
+				regexp.MustCompile(`.*_test\.go`),
+			},
+			[]*regexp.Regexp{},
+		)
+
 		output = append(output, &GoProject{
-			ProjectPath:  path.Join(projectPath, path.Dir(p)),
+			ProjectPath:  path.Join(index.Root, path.Dir(p)),
 			RelativePath: path.Dir(p),
+			HasTests:     len(testFiles) > 0,
+			Cache:        settings.Cache,
 		})
 	}
 
@@ -49,9 +57,14 @@ func (p *GoProject) GetRelativePath() string {
 	return p.RelativePath
 }
 
+func (p *GoProject) taskID(taskType string) task.ID {
+	return task.ID{Type: taskType, Project: util.PathToSafeName(p.RelativePath), Language: "go"}
+}
+
 func (p *GoProject) AddTasks(taskFile *task.TaskFile) error {
 	adders := []TaskAdder{
 		p.addCacheKeyTask,
+		p.addCachePathsTask,
 		p.addCacheLoadTask,
 		p.addCacheSaveTask,
 		p.addDepsTask,
@@ -71,8 +84,7 @@ func (p *GoProject) AddTasks(taskFile *task.TaskFile) error {
 }
 
 func (p *GoProject) addCacheKeyTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("cachekey-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("cachekey"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Generates: []string{".task-meta-cache-key"},
 		Commands: []task.Command{
@@ -100,58 +112,64 @@ fi
 `,
 			},
 		},
-	}
+	})
+}
 
-	return nil
+func (p *GoProject) addCachePathsTask(taskFile *task.TaskFile) error {
+	return taskFile.AddTask(p.taskID("cachepaths"), p.RelativePath, &task.Task{
+		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
+		Generates: []string{".task-meta-cache-paths"},
+		Commands: []task.Command{
+			{Command: `echo "$(go env GOMODCACHE) $(go env GOCACHE)" > .task-meta-cache-paths`},
+		},
+	})
 }
 
 func (p *GoProject) addCacheLoadTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("cacheload-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	if p.Cache.LoadCommand() == "" {
+		return nil
+	}
+
+	return taskFile.AddTask(p.taskID("cacheload"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Dependencies: []string{
-			fmt.Sprintf("cachekey-%s-go", util.PathToSafeName(p.RelativePath)),
+			p.taskID("cachekey").Name(),
 		},
 		Commands: []task.Command{
-			{Command: cacheLoadCommand()},
+			{Command: p.Cache.LoadCommand()},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *GoProject) addCacheSaveTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("cachesave-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	if p.Cache.SaveCommand() == "" {
+		return nil
+	}
+
+	return taskFile.AddTask(p.taskID("cachesave"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Dependencies: []string{
-			fmt.Sprintf("cachekey-%s-go", util.PathToSafeName(p.RelativePath)),
+			p.taskID("cachekey").Name(),
+			p.taskID("cachepaths").Name(),
 		},
 		Commands: []task.Command{
-			{Command: `echo "$(go env GOMODCACHE) $(go env GOCACHE)" > .task-meta-cache-paths`},
-			{Command: cacheSaveCommand()},
+			{Command: p.Cache.SaveCommand()},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *GoProject) addDepsTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("deps-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("deps"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `go mod download`},
 			{Command: `(go tool || true) | (grep '\.' || true) | while read t; do go build -o /dev/null $t; done`},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *GoProject) addLintTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("lint-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("lint"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `
@@ -188,47 +206,39 @@ fi
 exit $exit_code
 `},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *GoProject) addLintFixTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("lintfix-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("lintfix"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `gofmt -s -w .`},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *GoProject) addTestTask(taskFile *task.TaskFile) error {
-	testFiles, err := util.Find(
-		p.ProjectPath,
-		util.FIND_FILES,
-		[]*regexp.Regexp{
-			regexp.MustCompile(`.*_test\.go`),
-		},
-		[]*regexp.Regexp{},
-	)
-	if err != nil {
-		return fmt.Errorf("error checking for Go test files: %w", err)
-	}
-
-	if len(testFiles) == 0 {
+	if !p.HasTests {
 		return nil
 	}
 
-	name := fmt.Sprintf("test-%s-go", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("test"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
-			{Command: `go test ./...`},
+			{Command: `
+# JUnit output needs go-junit-report, which only runs if the project has it as a tool
+if grep go-junit-report go.mod >/dev/null; then
+  set -o pipefail
+  go test -v -coverprofile=.task-meta-coverage.out ./... 2>&1 | go tool go-junit-report -iocopy -set-exit-code -out .task-meta-junit.xml
+else
+  go test -coverprofile=.task-meta-coverage.out ./...
+fi
+`},
 		},
-	}
-
-	return nil
+		Artifacts: []task.Artifact{
+			{Name: "junit", Kind: task.ArtifactTestReport, Paths: []string{".task-meta-junit.xml"}},
+			{Name: "coverage", Kind: task.ArtifactCoverage, Paths: []string{".task-meta-coverage.out"}},
+		},
+	})
 }
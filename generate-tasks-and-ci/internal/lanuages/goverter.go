@@ -19,11 +19,10 @@ type GoverterProject struct {
 	GoverterFilePaths []string
 }
 
-func FindGoverterProjects(projectPath string) ([]Project, error) {
+func FindGoverterProjects(index *util.FileIndex, _ Settings) ([]Project, error) {
 	output := []Project{}
 
-	goModPaths, err := util.Find(
-		projectPath,
+	goModPaths := index.Find(
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/)go\.mod`),
@@ -32,26 +31,22 @@ func FindGoverterProjects(projectPath string) ([]Project, error) {
 			regexp.MustCompile(`(^|/)\.git/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for Goverter projects: %w", err)
-	}
 
 	for _, p := range goModPaths {
-		goModPath := path.Join(projectPath, p)
-		match, err := util.FileContains(goModPath, "github.com/jmattheis/goverter/cmd/goverter")
+		match, err := util.FileContains(path.Join(index.Root, p), "github.com/jmattheis/goverter/cmd/goverter")
 		if err != nil {
 			return nil, fmt.Errorf("error searching for Goverter projects: %w", err)
 		}
 
 		if match {
-			goverterFiles, err := findGoverterProjectFiles(path.Dir(goModPath))
+			goverterFiles, err := findGoverterProjectFiles(index, path.Dir(p))
 			if err != nil {
 				return nil, fmt.Errorf("error searching for Goverter projects: %w", err)
 			}
 
 			if len(goverterFiles) > 0 {
 				output = append(output, &GoverterProject{
-					ProjectPath:       path.Join(projectPath, path.Dir(p)),
+					ProjectPath:       path.Join(index.Root, path.Dir(p)),
 					RelativePath:      path.Dir(p),
 					GoverterFilePaths: goverterFiles,
 				})
@@ -62,9 +57,9 @@ func FindGoverterProjects(projectPath string) ([]Project, error) {
 	return output, nil
 }
 
-func findGoverterProjectFiles(projectPath string) ([]string, error) {
-	goFilePaths, err := util.Find(
-		projectPath,
+func findGoverterProjectFiles(index *util.FileIndex, relativePath string) ([]string, error) {
+	goFilePaths := index.FindWithin(
+		relativePath,
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/).*\.go$`),
@@ -73,13 +68,10 @@ func findGoverterProjectFiles(projectPath string) ([]string, error) {
 			regexp.MustCompile(`(^|/)\.git/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for Go files within Goverter project: %w", err)
-	}
 
 	out := map[string]struct{}{}
 	for _, filePath := range goFilePaths {
-		match, err := util.FileContains(path.Join(projectPath, filePath), "// goverter:converter")
+		match, err := util.FileContains(path.Join(index.Root, relativePath, filePath), "// goverter:converter")
 		if err != nil {
 			return nil, fmt.Errorf("error checking for Goverter file: %w", err)
 		}
@@ -100,6 +92,10 @@ func (p *GoverterProject) GetRelativePath() string {
 	return p.RelativePath
 }
 
+func (p *GoverterProject) taskID(taskType string) task.ID {
+	return task.ID{Type: taskType, Project: util.PathToSafeName(p.RelativePath), Language: "goverter"}
+}
+
 func (p *GoverterProject) AddTasks(taskFile *task.TaskFile) error {
 	adders := []TaskAdder{
 		p.addGenTask,
@@ -116,7 +112,6 @@ func (p *GoverterProject) AddTasks(taskFile *task.TaskFile) error {
 }
 
 func (p *GoverterProject) addGenTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("gen-%s-goverter", util.PathToSafeName(p.RelativePath))
 	safePaths := make([]string, len(p.GoverterFilePaths))
 	for i, path := range p.GoverterFilePaths {
 		safePaths[i] = strconv.Quote(path)
@@ -125,14 +120,12 @@ func (p *GoverterProject) addGenTask(taskFile *task.TaskFile) error {
 	// sort paths to make the output deterministic
 	slices.Sort(safePaths)
 
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("gen"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{
 				Command: fmt.Sprintf("go tool github.com/jmattheis/goverter/cmd/goverter gen %s", strings.Join(safePaths, " ")),
 			},
 		},
-	}
-
-	return nil
+	})
 }
@@ -18,6 +18,7 @@ type JSProject struct {
 	RelativePath      string
 	PackageManagerCmd string
 	Config            PackageJSON
+	Cache             CacheBackend
 }
 
 type PackageJSON struct {
@@ -26,11 +27,10 @@ type PackageJSON struct {
 	PackageManager string            `json:"packageManager"`
 }
 
-func FindJSProjects(projectPath string) ([]Project, error) {
+func FindJSProjects(index *util.FileIndex, settings Settings) ([]Project, error) {
 	output := []Project{}
 
-	packageJSONPaths, err := util.Find(
-		projectPath,
+	packageJSONPaths := index.Find(
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/)package\.json`),
@@ -40,12 +40,9 @@ func FindJSProjects(projectPath string) ([]Project, error) {
 			regexp.MustCompile(`(^|/)node_modules/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for JS/TS projects: %w", err)
-	}
 
 	for _, p := range packageJSONPaths {
-		contents, err := os.ReadFile(path.Join(projectPath, p))
+		contents, err := os.ReadFile(path.Join(index.Root, p))
 		if err != nil {
 			return nil, fmt.Errorf("error reading package.json: %w", err)
 		}
@@ -72,10 +69,11 @@ func FindJSProjects(projectPath string) ([]Project, error) {
 		}
 
 		output = append(output, &JSProject{
-			ProjectPath:       path.Join(projectPath, path.Dir(p)),
+			ProjectPath:       path.Join(index.Root, path.Dir(p)),
 			RelativePath:      path.Dir(p),
 			PackageManagerCmd: packageManagerCmd,
 			Config:            config,
+			Cache:             settings.Cache,
 		})
 	}
 
@@ -90,9 +88,14 @@ func (p *JSProject) GetRelativePath() string {
 	return p.RelativePath
 }
 
+func (p *JSProject) taskID(taskType string) task.ID {
+	return task.ID{Type: taskType, Project: util.PathToSafeName(p.RelativePath), Language: "js"}
+}
+
 func (p *JSProject) AddTasks(taskFile *task.TaskFile) error {
 	adders := []TaskAdder{
 		p.addCacheKeyTask,
+		p.addCachePathsTask,
 		p.addCacheLoadTask,
 		p.addCacheSaveTask,
 		p.addDepsTask,
@@ -112,8 +115,7 @@ func (p *JSProject) AddTasks(taskFile *task.TaskFile) error {
 }
 
 func (p *JSProject) addCacheKeyTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("cachekey-%s-js", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("cachekey"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Generates: []string{".task-meta-cache-key"},
 		Commands: []task.Command{
@@ -143,29 +145,10 @@ fi
 `,
 			},
 		},
-	}
-
-	return nil
+	})
 }
 
-func (p *JSProject) addCacheLoadTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("cacheload-%s-js", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
-		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
-		Dependencies: []string{
-			fmt.Sprintf("cachekey-%s-js", util.PathToSafeName(p.RelativePath)),
-		},
-		Commands: []task.Command{
-			{Command: cacheLoadCommand()},
-		},
-	}
-
-	return nil
-}
-
-func (p *JSProject) addCacheSaveTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("cachesave-%s-js", util.PathToSafeName(p.RelativePath))
-
+func (p *JSProject) addCachePathsTask(taskFile *task.TaskFile) error {
 	cachePathCmd := ""
 	switch p.PackageManagerCmd {
 	case "pnpm":
@@ -175,21 +158,49 @@ func (p *JSProject) addCacheSaveTask(taskFile *task.TaskFile) error {
 		cachePathCmd = "yarn cache dir"
 
 	default:
-		return fmt.Errorf("encountered unsupported package manager '%s' when generating cachesave-js task", p.PackageManagerCmd)
+		return fmt.Errorf("encountered unsupported package manager '%s' when generating cachepaths-js task", p.PackageManagerCmd)
 	}
 
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("cachepaths"), p.RelativePath, &task.Task{
+		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
+		Generates: []string{".task-meta-cache-paths"},
+		Commands: []task.Command{
+			{Command: cachePathCmd + ` > .task-meta-cache-paths`},
+		},
+	})
+}
+
+func (p *JSProject) addCacheLoadTask(taskFile *task.TaskFile) error {
+	if p.Cache.LoadCommand() == "" {
+		return nil
+	}
+
+	return taskFile.AddTask(p.taskID("cacheload"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Dependencies: []string{
-			fmt.Sprintf("cachekey-%s-js", util.PathToSafeName(p.RelativePath)),
+			p.taskID("cachekey").Name(),
 		},
 		Commands: []task.Command{
-			{Command: cachePathCmd + ` > .task-meta-cache-paths`},
-			{Command: cacheSaveCommand()},
+			{Command: p.Cache.LoadCommand()},
 		},
+	})
+}
+
+func (p *JSProject) addCacheSaveTask(taskFile *task.TaskFile) error {
+	if p.Cache.SaveCommand() == "" {
+		return nil
 	}
 
-	return nil
+	return taskFile.AddTask(p.taskID("cachesave"), p.RelativePath, &task.Task{
+		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
+		Dependencies: []string{
+			p.taskID("cachekey").Name(),
+			p.taskID("cachepaths").Name(),
+		},
+		Commands: []task.Command{
+			{Command: p.Cache.SaveCommand()},
+		},
+	})
 }
 
 func (p *JSProject) addDepsTask(taskFile *task.TaskFile) error {
@@ -214,13 +225,10 @@ func (p *JSProject) addDepsTask(taskFile *task.TaskFile) error {
 		return fmt.Errorf("encountered unsupported package manager '%s' when generating deps-js task", p.PackageManagerCmd)
 	}
 
-	name := fmt.Sprintf("deps-%s-js", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("deps"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands:  cmds,
-	}
-
-	return nil
+	})
 }
 
 func (p *JSProject) addLintTask(taskFile *task.TaskFile) error {
@@ -228,15 +236,12 @@ func (p *JSProject) addLintTask(taskFile *task.TaskFile) error {
 		return nil
 	}
 
-	name := fmt.Sprintf("lint-%s-js", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("lint"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: fmt.Sprintf(`%s lint`, p.PackageManagerCmd)},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *JSProject) addLintFixTask(taskFile *task.TaskFile) error {
@@ -244,15 +249,12 @@ func (p *JSProject) addLintFixTask(taskFile *task.TaskFile) error {
 		return nil
 	}
 
-	name := fmt.Sprintf("lintfix-%s-js", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("lintfix"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: fmt.Sprintf(`%s lintfix`, p.PackageManagerCmd)},
 		},
-	}
-
-	return nil
+	})
 }
 
 func (p *JSProject) addTestTask(taskFile *task.TaskFile) error {
@@ -260,13 +262,14 @@ func (p *JSProject) addTestTask(taskFile *task.TaskFile) error {
 		return nil
 	}
 
-	name := fmt.Sprintf("test-%s-js", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("test"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: fmt.Sprintf(`%s test`, p.PackageManagerCmd)},
 		},
-	}
-
-	return nil
+		// test runners differ, but most write coverage here when it's enabled
+		Artifacts: []task.Artifact{
+			{Name: "coverage", Kind: task.ArtifactCoverage, Paths: []string{"coverage"}},
+		},
+	})
 }
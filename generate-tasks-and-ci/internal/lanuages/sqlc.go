@@ -1,7 +1,6 @@
 package lanuages
 
 import (
-	"fmt"
 	"path"
 	"regexp"
 
@@ -14,11 +13,10 @@ type SQLCProject struct {
 	RelativePath string
 }
 
-func FindSQLCProjects(projectPath string) ([]Project, error) {
+func FindSQLCProjects(index *util.FileIndex, _ Settings) ([]Project, error) {
 	output := []Project{}
 
-	sqlcGenPaths, err := util.Find(
-		projectPath,
+	sqlcGenPaths := index.Find(
 		util.FIND_FILES,
 		[]*regexp.Regexp{
 			regexp.MustCompile(`(^|/)sqlc\.ya?ml`),
@@ -27,13 +25,10 @@ func FindSQLCProjects(projectPath string) ([]Project, error) {
 			regexp.MustCompile(`(^|/)\.git/`),
 		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for SQLC projects: %w", err)
-	}
 
 	for _, p := range sqlcGenPaths {
 		output = append(output, &SQLCProject{
-			ProjectPath:  path.Join(projectPath, path.Dir(p)),
+			ProjectPath:  path.Join(index.Root, path.Dir(p)),
 			RelativePath: path.Dir(p),
 		})
 	}
@@ -49,6 +44,10 @@ func (p *SQLCProject) GetRelativePath() string {
 	return p.RelativePath
 }
 
+func (p *SQLCProject) taskID(taskType string) task.ID {
+	return task.ID{Type: taskType, Project: util.PathToSafeName(p.RelativePath), Language: "sqlc"}
+}
+
 func (p *SQLCProject) AddTasks(taskFile *task.TaskFile) error {
 	adders := []TaskAdder{
 		p.addGenTask,
@@ -65,13 +64,10 @@ func (p *SQLCProject) AddTasks(taskFile *task.TaskFile) error {
 }
 
 func (p *SQLCProject) addGenTask(taskFile *task.TaskFile) error {
-	name := fmt.Sprintf("gen-%s-sqlc", util.PathToSafeName(p.RelativePath))
-	taskFile.Tasks[name] = &task.Task{
+	return taskFile.AddTask(p.taskID("gen"), p.RelativePath, &task.Task{
 		Directory: path.Join("{{.ROOT_DIR}}", p.RelativePath),
 		Commands: []task.Command{
 			{Command: `sqlc generate`},
 		},
-	}
-
-	return nil
+	})
 }
@@ -20,6 +20,9 @@ type IncludeTarget struct {
 }
 
 type Task struct {
+	ID     ID     `yaml:"-"`
+	Source string `yaml:"-"`
+
 	Directory    string            `yaml:"dir,omitempty"`
 	Environment  map[string]string `yaml:"env,omitempty"`
 	Dependencies []string          `yaml:"deps,omitempty"`
@@ -27,6 +30,44 @@ type Task struct {
 	Generates    []string          `yaml:"generates,omitempty"`
 	Internal     bool              `yaml:"internal,omitempty"`
 	Commands     []Command         `yaml:"cmds"`
+
+	// Artifacts are outputs of the task that CI should keep. They only affect the CI config, not the taskfile.
+	Artifacts []Artifact `yaml:"-"`
+
+	// Registry is the container registry that the task pushes to, if any. Like Artifacts, it only affects the CI config.
+	Registry string `yaml:"-"`
+}
+
+type ArtifactKind string
+
+const (
+	ArtifactTestReport ArtifactKind = "junit"
+	ArtifactCoverage   ArtifactKind = "coverage"
+	ArtifactBinary     ArtifactKind = "binary"
+	ArtifactLintReport ArtifactKind = "sarif"
+	ArtifactImage      ArtifactKind = "image"
+)
+
+// Artifact is a named set of files produced by a task, with paths relative to the project that generated it.
+type Artifact struct {
+	Name  string
+	Kind  ArtifactKind
+	Paths []string
+}
+
+// ID is the structured identity of a generated task. Aggregate tasks (e.g. "lint") have no ID.
+type ID struct {
+	Type     string
+	Project  string
+	Language string
+}
+
+func (id ID) Name() string {
+	if id.Language == "" {
+		return fmt.Sprintf("%s-%s", id.Type, id.Project)
+	}
+
+	return fmt.Sprintf("%s-%s-%s", id.Type, id.Project, id.Language)
 }
 
 type Command struct {
@@ -34,6 +75,24 @@ type Command struct {
 	Task    string `yaml:"task,omitempty"`
 }
 
+// AddTask adds a task generated by the project at source (a path relative to the repo root), failing if another task already has the same name.
+func (f *TaskFile) AddTask(id ID, source string, t *Task) error {
+	name := id.Name()
+	if existing, ok := f.Tasks[name]; ok {
+		if existing.Source == source {
+			return fmt.Errorf("task %s is generated more than once by the project at %s", name, source)
+		}
+
+		return fmt.Errorf("task %s is generated by projects at both %s and %s; rename one of them so that their names are distinct", name, existing.Source, source)
+	}
+
+	t.ID = id
+	t.Source = source
+	f.Tasks[name] = t
+
+	return nil
+}
+
 func LoadTaskFile(path string) (*TaskFile, error) {
 	_, err := os.Stat(path)
 	if os.IsNotExist(err) {
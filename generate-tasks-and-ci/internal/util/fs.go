@@ -2,66 +2,12 @@ package util
 
 import (
 	"bufio"
-	"io/fs"
+	"errors"
 	"os"
 	"regexp"
 	"strings"
 )
 
-var (
-	FIND_FILES = 1
-	FIND_DIRS  = 2
-)
-
-func Find(projectPath string, targets int, patterns []*regexp.Regexp, excludePatterns []*regexp.Regexp) ([]string, error) {
-	findFiles := targets&FIND_FILES != 0
-	findDirs := targets&FIND_DIRS != 0
-	matches := []string{}
-
-	projectFs := os.DirFS(projectPath)
-	err := fs.WalkDir(projectFs, ".", func(path string, d fs.DirEntry, err error) error {
-		relativePath := strings.TrimPrefix(path, projectPath)
-		match := false
-
-		// skip hidden directories
-		if strings.HasPrefix(path, ".") {
-			return nil
-		}
-
-		for i := range patterns {
-			if patterns[i].MatchString(relativePath) {
-				match = true
-				break
-			}
-		}
-
-		if match {
-			for i := range excludePatterns {
-				if excludePatterns[i].MatchString(relativePath) {
-					match = false
-					break
-				}
-			}
-		}
-
-		if match && findDirs && d.IsDir() {
-			matches = append(matches, path)
-		}
-
-		if match && findFiles && !d.IsDir() {
-			matches = append(matches, path)
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return matches, nil
-}
-
 func PathToSafeName(path string) string {
 	if path == "." {
 		return "root"
@@ -98,7 +44,7 @@ func FileContains(path string, line string) (bool, error) {
 
 func FileExists(path string) (bool, error) {
 	_, err := os.Stat(path)
-	if err == os.ErrNotExist {
+	if errors.Is(err, os.ErrNotExist) {
 		return false, nil
 	} else if err != nil {
 		return false, err
@@ -108,7 +54,7 @@ func FileExists(path string) (bool, error) {
 
 func DirExists(path string) (bool, error) {
 	stat, err := os.Stat(path)
-	if err == os.ErrNotExist {
+	if errors.Is(err, os.ErrNotExist) {
 		return false, nil
 	} else if err != nil {
 		return false, err
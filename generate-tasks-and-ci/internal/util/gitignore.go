@@ -0,0 +1,177 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// IgnoreMatcher implements the subset of gitignore semantics needed to prune a project walk: wildcards, "**", anchoring, directory-only patterns and negation.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// AddPatterns adds gitignore-style patterns relative to base, which is a slash-separated path relative to the project root ("" or "." for the root itself).
+func (m *IgnoreMatcher) AddPatterns(base string, patterns []string) {
+	if base == "." {
+		base = ""
+	}
+
+	for _, p := range patterns {
+		rule, ok := parseIgnoreRule(base, p)
+		if ok {
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// AddFile adds patterns from a gitignore-style file, if it exists.
+func (m *IgnoreMatcher) AddFile(base string, filePath string) error {
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	m.AddPatterns(base, patterns)
+	return nil
+}
+
+// Match reports whether the slash-separated path (relative to the project root) is ignored. As in git, the last matching pattern wins.
+func (m *IgnoreMatcher) Match(relativePath string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		target := relativePath
+		if r.base != "" {
+			if !strings.HasPrefix(relativePath, r.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(relativePath, r.base+"/")
+		}
+
+		if r.pattern.MatchString(target) {
+			ignored = !r.negate
+		}
+	}
+
+	return ignored
+}
+
+func parseIgnoreRule(base string, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// patterns containing a slash are relative to the base, others match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "(^|/)" + expr + "$"
+	}
+
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = pattern
+	return rule, true
+}
+
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("/.*")
+			i += 2
+
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+
+		case c == '*':
+			sb.WriteString("[^/]*")
+
+		case c == '?':
+			sb.WriteString("[^/]")
+
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+
+		case c == '\\' && i+1 < len(glob):
+			sb.WriteString(regexp.QuoteMeta(string(glob[i+1])))
+			i++
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
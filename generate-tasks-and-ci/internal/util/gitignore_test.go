@@ -0,0 +1,43 @@
+package util
+
+import "testing"
+
+func TestIgnoreMatcher(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Base     string
+		Patterns []string
+		Path     string
+		IsDir    bool
+		Expected bool
+	}{
+		{Name: "basename at any depth", Patterns: []string{"build"}, Path: "a/b/build", IsDir: true, Expected: true},
+		{Name: "no match", Patterns: []string{"build"}, Path: "a/builder", IsDir: true, Expected: false},
+		{Name: "wildcard", Patterns: []string{"*.log"}, Path: "logs/today.log", Expected: true},
+		{Name: "wildcard does not cross directories", Patterns: []string{"logs/*.log"}, Path: "logs/old/today.log", Expected: false},
+		{Name: "anchored", Patterns: []string{"/gen"}, Path: "gen", IsDir: true, Expected: true},
+		{Name: "anchored does not match nested", Patterns: []string{"/gen"}, Path: "a/gen", IsDir: true, Expected: false},
+		{Name: "double star prefix", Patterns: []string{"**/fixtures"}, Path: "a/b/fixtures", IsDir: true, Expected: true},
+		{Name: "double star middle", Patterns: []string{"a/**/fixtures"}, Path: "a/fixtures", IsDir: true, Expected: true},
+		{Name: "double star suffix", Patterns: []string{"a/**"}, Path: "a/b/c", Expected: true},
+		{Name: "dir only matches dirs", Patterns: []string{"out/"}, Path: "out", IsDir: true, Expected: true},
+		{Name: "dir only skips files", Patterns: []string{"out/"}, Path: "out", Expected: false},
+		{Name: "negation", Patterns: []string{"*.yml", "!keep.yml"}, Path: "keep.yml", Expected: false},
+		{Name: "last match wins", Patterns: []string{"!keep.yml", "*.yml"}, Path: "keep.yml", Expected: true},
+		{Name: "comments are ignored", Patterns: []string{"# build"}, Path: "build", IsDir: true, Expected: false},
+		{Name: "character class", Patterns: []string{"v[0-9]"}, Path: "v1", IsDir: true, Expected: true},
+		{Name: "relative to base", Base: "web", Patterns: []string{"/dist"}, Path: "web/dist", IsDir: true, Expected: true},
+		{Name: "outside of base", Base: "web", Patterns: []string{"dist"}, Path: "api/dist", IsDir: true, Expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			m := &IgnoreMatcher{}
+			m.AddPatterns(c.Base, c.Patterns)
+			actual := m.Match(c.Path, c.IsDir)
+			if actual != c.Expected {
+				t.Errorf("expected %v, got %v", c.Expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package util
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	FIND_FILES = 1
+	FIND_DIRS  = 2
+)
+
+// directories that never contain projects of their own, so are pruned before descending into them
+var prunedDirNames = []string{
+	"node_modules",
+	"target",
+	"vendor",
+}
+
+// a directory containing this file is skipped entirely, along with everything below it
+const ignoreMarkerFileName = ".tedium-ignore"
+
+// FileIndex is a snapshot of the files and directories in a project, built with a single walk and shared by all project finders.
+type FileIndex struct {
+	Root string
+
+	files []string
+	dirs  []string
+}
+
+// NewFileIndex walks the project at root once, honouring .gitignore files, .git/info/exclude and the extra gitignore-style ignore patterns.
+func NewFileIndex(root string, ignore []string) (*FileIndex, error) {
+	index := &FileIndex{Root: root}
+
+	projectIgnores := &IgnoreMatcher{}
+	projectIgnores.AddPatterns("", ignore)
+
+	gitIgnores := &IgnoreMatcher{}
+	err := gitIgnores.AddFile("", path.Join(root, ".git", "info", "exclude"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading git exclude file: %w", err)
+	}
+
+	w := &indexWalker{
+		index:          index,
+		projectIgnores: projectIgnores,
+		gitIgnores:     gitIgnores,
+		visited:        map[string]struct{}{},
+	}
+
+	err = w.enter(root, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	// symlinked directories are only followed once every real directory has been indexed, so that a directory reached both ways is
+	// indexed under its real path
+	for len(w.symlinks) > 0 {
+		link := w.symlinks[0]
+		w.symlinks = w.symlinks[1:]
+
+		err = w.enter(link.fullPath, link.relativePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
+}
+
+// Find returns paths relative to the project root that match any of the patterns and none of the exclude patterns.
+func (i *FileIndex) Find(targets int, patterns []*regexp.Regexp, excludePatterns []*regexp.Regexp) []string {
+	return i.FindWithin(".", targets, patterns, excludePatterns)
+}
+
+// FindWithin is like Find, but only considers paths below dir and returns paths relative to it.
+func (i *FileIndex) FindWithin(dir string, targets int, patterns []*regexp.Regexp, excludePatterns []*regexp.Regexp) []string {
+	dir = path.Clean(dir)
+	matches := []string{}
+
+	search := func(candidates []string) {
+		for _, p := range candidates {
+			relativePath := p
+			if dir != "." {
+				if !strings.HasPrefix(p, dir+"/") {
+					continue
+				}
+				relativePath = strings.TrimPrefix(p, dir+"/")
+			}
+
+			if matchesAny(relativePath, patterns) && !matchesAny(relativePath, excludePatterns) {
+				matches = append(matches, relativePath)
+			}
+		}
+	}
+
+	if targets&FIND_DIRS != 0 {
+		search(i.dirs)
+	}
+
+	if targets&FIND_FILES != 0 {
+		search(i.files)
+	}
+
+	slices.Sort(matches)
+	return matches
+}
+
+func matchesAny(s string, patterns []*regexp.Regexp) bool {
+	for _, p := range patterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type indexWalker struct {
+	index          *FileIndex
+	projectIgnores *IgnoreMatcher
+	gitIgnores     *IgnoreMatcher
+	visited        map[string]struct{}
+	symlinks       []symlinkedDir
+}
+
+type symlinkedDir struct {
+	fullPath     string
+	relativePath string
+}
+
+// enter indexes a directory and everything below it, unless its real path has already been indexed. Tracking real paths means that
+// symlinked directories can be followed without looping.
+func (w *indexWalker) enter(fullPath string, relativePath string) error {
+	realPath, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", relativePath, err)
+	}
+	if _, ok := w.visited[realPath]; ok {
+		return nil
+	}
+	w.visited[realPath] = struct{}{}
+
+	if relativePath != "." {
+		w.index.dirs = append(w.index.dirs, relativePath)
+	}
+
+	return w.walk(fullPath, relativePath)
+}
+
+func (w *indexWalker) walk(fullPath string, relativePath string) error {
+	err := w.gitIgnores.AddFile(relativePath, path.Join(fullPath, ".gitignore"))
+	if err != nil {
+		return fmt.Errorf("error reading .gitignore in %s: %w", relativePath, err)
+	}
+
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return fmt.Errorf("error reading directory %s: %w", relativePath, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		entryFullPath := path.Join(fullPath, name)
+		entryRelativePath := path.Join(relativePath, name)
+
+		isDir := entry.IsDir()
+		isSymlink := entry.Type()&fs.ModeSymlink != 0
+		if isSymlink {
+			stat, err := os.Stat(entryFullPath)
+			if err != nil {
+				// broken links are not an error, there's just nothing to index
+				continue
+			}
+			isDir = stat.IsDir()
+		}
+
+		// skip hidden files and directories
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if isDir && slices.Contains(prunedDirNames, name) {
+			continue
+		}
+
+		if w.projectIgnores.Match(entryRelativePath, isDir) || w.gitIgnores.Match(entryRelativePath, isDir) {
+			continue
+		}
+
+		if isDir {
+			hasIgnoreMarker, err := FileExists(path.Join(entryFullPath, ignoreMarkerFileName))
+			if err != nil {
+				return fmt.Errorf("error checking for ignore marker in %s: %w", entryRelativePath, err)
+			}
+			if hasIgnoreMarker {
+				continue
+			}
+
+			if isSymlink {
+				w.symlinks = append(w.symlinks, symlinkedDir{fullPath: entryFullPath, relativePath: entryRelativePath})
+				continue
+			}
+
+			err = w.enter(entryFullPath, entryRelativePath)
+			if err != nil {
+				return err
+			}
+		} else {
+			w.index.files = append(w.index.files, entryRelativePath)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestFileIndex(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"go.mod":                             "",
+		"api/go.mod":                         "",
+		"web/package.json":                   "",
+		"web/node_modules/dep/package.json":  "",
+		"vendor/example.com/dep/go.mod":      "",
+		"rust/target/debug/go.mod":           "",
+		"generated/go.mod":                   "",
+		"excluded/go.mod":                    "",
+		"fixtures/go.mod":                    "",
+		"a/.hidden/go.mod":                   "",
+		".gitignore":                         "generated/\n",
+		".git/info/exclude":                  "/excluded\n",
+		"web/.gitignore":                     "!node_modules\n",
+		"api/internal/testdata/repo/go.mod":  "",
+		"api/internal/testdata/repo/main.go": "",
+	}
+	for p, contents := range files {
+		fullPath := path.Join(root, p)
+		err := os.MkdirAll(path.Dir(fullPath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(fullPath, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a symlink loop should be walked once, not forever
+	err := os.Symlink("..", path.Join(root, "api", "loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := NewFileIndex(root, []string{"fixtures"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actual := index.Find(
+		FIND_FILES,
+		[]*regexp.Regexp{regexp.MustCompile(`(^|/)(go\.mod|package\.json)$`)},
+		[]*regexp.Regexp{},
+	)
+	// projects in testdata directories are real projects as far as the index is concerned
+	expected := []string{"api/go.mod", "api/internal/testdata/repo/go.mod", "go.mod", "web/package.json"}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual = index.FindWithin(
+		"api",
+		FIND_FILES,
+		[]*regexp.Regexp{regexp.MustCompile(`(^|/)go\.mod$`)},
+		[]*regexp.Regexp{},
+	)
+	expected = []string{"go.mod", "internal/testdata/repo/go.mod"}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFileIndexSymlinkedDir(t *testing.T) {
+	root := t.TempDir()
+
+	err := os.MkdirAll(path.Join(root, "b", "nested"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(root, "b", "nested", "go.mod"), []byte(""), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the links sort before the directories they point to, but mustn't claim them
+	err = os.Symlink("b", path.Join(root, "a-link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(path.Join("b", "nested"), path.Join(root, "a-nested-link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := NewFileIndex(root, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actual := index.Find(FIND_FILES|FIND_DIRS, []*regexp.Regexp{regexp.MustCompile(`.`)}, []*regexp.Regexp{})
+	expected := []string{"b", "b/nested", "b/nested/go.mod"}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -1,164 +1,240 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"slices"
 	"strings"
+
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/config"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/dockerfile"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/files"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/labels"
 )
 
-var rootPath = "/tedium/repo"
+// listFlag collects the values of a flag that can be given more than once.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
 
 func main() {
-	// default labels - all empty
-	labels := map[string]string{
-		// labels we will try to set later
-		"org.opencontainers.image.title": "",
+	var rootPath, configPath, summaryPath string
+	var set, strip, keep, exclude listFlag
+	flag.StringVar(&rootPath, "root", "/tedium/repo", "Repo path to target")
+	flag.StringVar(&configPath, "config", "", "Config file to read (default: "+config.FileName+" in the repo)")
+	flag.StringVar(&summaryPath, "summary", "", "File to write a Markdown summary of the changes to, for a PR description (default: stdout)")
+	flag.Var(&set, "set", "Label to set, as key=value (repeatable)")
+	flag.Var(&strip, "strip", "Label to remove (repeatable)")
+	flag.Var(&keep, "keep", "Label to leave alone (repeatable)")
+	flag.Var(&exclude, "exclude", "Gitignore-style pattern for Containerfiles to leave alone (repeatable)")
+	flag.Parse()
+
+	if configPath == "" {
+		configPath = filepath.Join(rootPath, config.FileName)
+	}
 
-		// common inherited to remove from base images
-		"org.opencontainers.image.description":   "",
-		"org.opencontainers.image.documentation": "",
-		"org.opencontainers.image.url":           "",
-		"org.opencontainers.image.vendor":        "",
-		"org.opencontainers.image.version":       "",
+	fileConfig, err := config.Load(configPath)
+	if err != nil {
+		slog.Error("error loading config", "error", err)
+		os.Exit(1)
 	}
 
-	// set labels from env if possible
-	repoName := os.Getenv("TEDIUM_REPO_NAME")
-	if repoName != "" {
-		labels["org.opencontainers.image.title"] = repoName
+	envConfig, err := config.FromEnv(os.Environ())
+	if err != nil {
+		slog.Error("error loading config from env", "error", err)
+		os.Exit(1)
 	}
 
-	// find files to update
-	err := fs.WalkDir(os.DirFS(rootPath), ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			slog.Error("error finding containerfiles", "error", err)
+	flagConfig := config.Config{Policy: config.Policy{Strip: strip, Keep: keep}, Exclude: exclude}
+	for _, pair := range set {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			slog.Error("labels to set must be key=value", "flag", pair)
 			os.Exit(1)
 		}
+		if flagConfig.Set == nil {
+			flagConfig.Set = map[string]string{}
+		}
+		flagConfig.Set[key] = value
+	}
 
-		if d.Name() == "Containerfile" || d.Name() == "Dockerfile" {
-			fullPath := filepath.Join(rootPath, path)
-			err := processFile(fullPath, labels)
-			if err != nil {
-				slog.Error("error processing file", "path", fullPath, "error", err)
-				os.Exit(1)
-			}
+	// flags override env, which overrides the file
+	cfg := fileConfig.Merge(envConfig).Merge(flagConfig)
+
+	repo, err := labels.ReadRepo(rootPath, labels.PlatformFromEnv())
+	if err != nil {
+		slog.Error("error reading repo details", "error", err)
+		os.Exit(1)
+	}
+
+	// find files to update, carrying on past any that fail so that one bad file doesn't hold up the rest
+	paths, findErr := files.Find(rootPath, cfg.Exclude)
+	if findErr != nil {
+		slog.Error("error finding containerfiles", "error", findErr)
+	}
+
+	summaries := []fileSummary{}
+	errs := []error{findErr}
+	for _, path := range paths {
+		summary, err := processFile(rootPath, path, repo, cfg)
+		if err != nil {
+			slog.Error("error processing file", "path", path, "error", err)
+			errs = append(errs, fmt.Errorf("error processing %s: %w", path, err))
+			summaries = append(summaries, fileSummary{Path: path, Err: err})
+			continue
+		}
+		if !summary.Empty() {
+			summaries = append(summaries, fileSummary{Path: path, Summary: summary})
 		}
+	}
 
-		return nil
-	})
+	err = writeSummary(summaryPath, summaries)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error writing summary: %w", err))
+	}
 
+	err = errors.Join(errs...)
 	if err != nil {
-		slog.Error("error finding containerfiles", "error", err)
+		slog.Error("some files could not be updated", "error", err)
 		os.Exit(1)
 	}
 }
 
-func processFile(path string, labels map[string]string) error {
+func processFile(rootPath string, relativePath string, repo labels.Repo, cfg config.Config) (dockerfile.Summary, error) {
+	path := filepath.Join(rootPath, relativePath)
 	slog.Info("processing file", "file", path)
 
-	// open the file and read it into lines
-	containerFile, err := os.Open(path)
+	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		return dockerfile.Summary{}, fmt.Errorf("error reading file: %w", err)
 	}
-	defer func() {
-		err := containerFile.Close()
-		if err != nil {
-			slog.Error("error closing file", "error", err)
-		}
-	}()
 
-	lines := []string{}
-	scanner := bufio.NewScanner(containerFile)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return dockerfile.Summary{}, fmt.Errorf("error reading file: %w", err)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+	f, err := dockerfile.Parse(contents)
+	if err != nil {
+		return dockerfile.Summary{}, fmt.Errorf("error parsing file: %w", err)
 	}
 
-	// process the actual lines
-	lines = processLines(lines, labels)
-	output := strings.Join(lines, "\n")
-	err = os.WriteFile(path, []byte(output), os.ModePerm)
+	existing, err := f.FinalLabels()
 	if err != nil {
-		return fmt.Errorf("error writing file: %w", err)
+		return dockerfile.Summary{}, fmt.Errorf("error reading labels: %w", err)
 	}
 
-	return nil
-}
+	changes, err := labels.For(repo, cfg, rootPath, relativePath, existing)
+	if err != nil {
+		return dockerfile.Summary{}, fmt.Errorf("error working out labels: %w", err)
+	}
 
-func processLines(lines []string, labels map[string]string) []string {
-	// separate final-stage lines from any earlier stages
-	finalStageLines := []string{}
-	nonFinalStageLines := []string{}
-	for _, line := range lines {
-		if strings.HasPrefix(strings.ToLower(line), "from ") {
-			nonFinalStageLines = append(nonFinalStageLines, finalStageLines...)
-			finalStageLines = []string{line}
-		} else {
-			finalStageLines = append(finalStageLines, line)
-		}
+	output, summary, err := dockerfile.UpdateLabels(contents, changes)
+	if err != nil {
+		return dockerfile.Summary{}, fmt.Errorf("error updating labels: %w", err)
 	}
 
-	// separate labels in the final stage
-	labelLines := []string{}
-	nonLabelLines := []string{}
-	for _, line := range finalStageLines {
-		if strings.HasPrefix(strings.ToLower(line), "label ") {
-			labelLines = append(labelLines, line)
-		} else {
-			nonLabelLines = append(nonLabelLines, line)
-		}
+	if bytes.Equal(output, contents) {
+		slog.Info("no changes", "file", path)
+		return dockerfile.Summary{}, nil
 	}
 
-	// capitalise "label" statements
-	for i, line := range labelLines {
-		labelLines[i] = "LABEL" + line[5:]
+	err = writeFileAtomic(path, output, info.Mode().Perm())
+	if err != nil {
+		return dockerfile.Summary{}, fmt.Errorf("error writing file: %w", err)
 	}
 
-	// insert or update labels
-	for key, value := range labels {
-		idx := slices.IndexFunc(labelLines, func(line string) bool {
-			return strings.HasPrefix(line, fmt.Sprintf("LABEL %s", key))
-		})
-		if idx < 0 {
-			labelLines = append(labelLines, fmt.Sprintf("LABEL %s=%q", key, value))
-		} else {
-			labelLines[idx] = fmt.Sprintf("LABEL %s=%q", key, value)
-		}
+	slog.Info("updated labels", "file", path, "added", summary.Added, "updated", summary.Updated, "removed", summary.Removed)
+	return summary, nil
+}
+
+// writeFileAtomic replaces a file via a temporary file in the same directory, so that it's never left half-written. Symlinks are followed,
+// so that the file they point to is replaced rather than the link itself.
+func writeFileAtomic(path string, data []byte, mode fs.FileMode) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// only fails once the file has been renamed away
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		_ = tmp.Close()
+		return err
 	}
 
-	slices.Sort(labelLines)
+	err = tmp.Chmod(mode)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
 
-	// reassemble final stage
-	nonLabelLines = append(nonLabelLines, "")
-	finalStageLines = append(nonLabelLines, labelLines...)
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
 
-	// reassemble file
-	lines = append(nonFinalStageLines, finalStageLines...)
-	lines = append(lines, "")
-	lines = removeExtraBlanks(lines)
+	return os.Rename(tmp.Name(), path)
+}
 
-	return lines
+type fileSummary struct {
+	Path    string
+	Summary dockerfile.Summary
+	Err     error
 }
 
-func removeExtraBlanks(lines []string) []string {
-	newLines := []string{}
+// writeSummary writes a Markdown list of the labels changed in each file, to summaryPath or stdout.
+func writeSummary(summaryPath string, summaries []fileSummary) error {
+	var sb strings.Builder
+	if len(summaries) == 0 {
+		sb.WriteString("No image labels were changed.\n")
+	}
 
-	// condense consecuitive blank lines
-	for _, line := range lines {
-		if len(newLines) > 0 && newLines[len(newLines)-1] == "" && line == "" {
+	for _, s := range summaries {
+		fmt.Fprintf(&sb, "- `%s`\n", s.Path)
+		if s.Err != nil {
+			fmt.Fprintf(&sb, "  - Not updated: %s\n", s.Err)
 			continue
 		}
-		newLines = append(newLines, line)
+		for _, change := range []struct {
+			Verb string
+			Keys []string
+		}{
+			{"Added", s.Summary.Added},
+			{"Updated", s.Summary.Updated},
+			{"Removed", s.Summary.Removed},
+		} {
+			if len(change.Keys) > 0 {
+				fmt.Fprintf(&sb, "  - %s `%s`\n", change.Verb, strings.Join(change.Keys, "`, `"))
+			}
+		}
+	}
+
+	if summaryPath == "" {
+		_, err := os.Stdout.WriteString(sb.String())
+		return err
 	}
 
-	return newLines
+	return os.WriteFile(summaryPath, []byte(sb.String()), 0644)
 }
@@ -1,156 +1,190 @@
 package main
 
 import (
-	"reflect"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/sergi/go-diff/diffmatchpatch"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/config"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/dockerfile"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/labels"
 )
 
-func TestProcessLines(t *testing.T) {
-	cases := []struct {
-		Name     string
-		Input    []string
-		Expected []string
-		Labels   map[string]string
-	}{
-		{
-			Name: "no labels",
-			Input: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-			},
-			Expected: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-			},
-			Labels: map[string]string{},
-		},
-
-		{
-			Name: "add a label",
-			Input: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-			},
-			Expected: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-				"LABEL foo=\"bar\"",
-				"",
-			},
-			Labels: map[string]string{"foo": "bar"},
-		},
-
-		{
-			Name: "update a label",
-			Input: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-				"LABEL foo=\"bob\"",
-			},
-			Expected: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-				"LABEL foo=\"bar\"",
-				"",
-			},
-			Labels: map[string]string{"foo": "bar"},
-		},
-
-		{
-			Name: "merge labels",
-			Input: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-				"LABEL fizz=\"buzz\"",
-			},
-			Expected: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-				"LABEL fizz=\"buzz\"",
-				"LABEL foo=\"bar\"",
-				"",
-			},
-			Labels: map[string]string{"foo": "bar"},
-		},
-
-		{
-			Name: "move labels",
-			Input: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"LABEL foo2=\"bar\"",
-				"RUN bar1",
-				"LABEL foo1=\"bar\"",
-				"RUN bar2",
-			},
-			Expected: []string{
-				"FROM init",
-				"RUN something",
-				"LABEL earlier-stage",
-				"FROM foo",
-				"RUN bar1",
-				"RUN bar2",
-				"",
-				"LABEL foo1=\"bar\"",
-				"LABEL foo2=\"bar\"",
-				"LABEL foo3=\"bar\"",
-				"",
-			},
-			Labels: map[string]string{"foo3": "bar"},
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.Name, func(t *testing.T) {
-			actual := processLines(c.Input, c.Labels)
-			if !reflect.DeepEqual(actual, c.Expected) {
-				dmp := diffmatchpatch.New()
-				diffs := dmp.DiffMain(strings.Join(actual, "\n"), strings.Join(c.Expected, "\n"), true)
-				t.Error("failed:\n" + dmp.DiffPrettyText(diffs))
-			}
-		})
+var testRepo = labels.Repo{Name: "example", WebURL: "https://github.com/me/example", License: "MIT"}
+
+func writeTestFile(t *testing.T, path string, contents string, mode os.FileMode) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(contents), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the umask may have changed the mode on creation
+	err = os.Chmod(path, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessFile(t *testing.T) {
+	rootPath := t.TempDir()
+	path := filepath.Join(rootPath, "Containerfile")
+	writeTestFile(t, path, "FROM alpine\nLABEL org.opencontainers.image.title=old\n", 0644)
+
+	summary, err := processFile(rootPath, "Containerfile", testRepo, config.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(summary.Added) == 0 || strings.Join(summary.Updated, ",") != "org.opencontainers.image.title" || len(summary.Removed) != 0 {
+		t.Errorf("expected labels to be added and the title updated, got %+v", summary)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), `LABEL org.opencontainers.image.title="example"`) {
+		t.Errorf("expected the title to be updated, got:\n%s", contents)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected the mode to stay 0644, got %#o", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(rootPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left behind, got %v", entries)
+	}
+}
+
+func TestProcessFileUnchanged(t *testing.T) {
+	rootPath := t.TempDir()
+	path := filepath.Join(rootPath, "Containerfile")
+	writeTestFile(t, path, "FROM alpine\n", 0644)
+
+	_, err := processFile(rootPath, "Containerfile", testRepo, config.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// any rewrite from here on would move the mtime forward
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(path, past, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := processFile(rootPath, "Containerfile", testRepo, config.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !summary.Empty() {
+		t.Errorf("expected no changes the second time, got %+v", summary)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("expected an unchanged file not to be rewritten, but its mtime moved to %v", info.ModTime())
+	}
+}
+
+func TestProcessFileSymlink(t *testing.T) {
+	rootPath := t.TempDir()
+	target := filepath.Join(rootPath, "shared", "Containerfile.base")
+	writeTestFile(t, target, "FROM alpine\n", 0644)
+
+	link := filepath.Join(rootPath, "app", "Containerfile")
+	err := os.MkdirAll(filepath.Dir(link), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join("..", "shared", "Containerfile.base"), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = processFile(rootPath, "app/Containerfile", testRepo, config.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symlink to be kept")
+	}
+
+	contents, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), "LABEL org.opencontainers.image.title") {
+		t.Errorf("expected the symlink's target to be updated, got:\n%s", contents)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+
+	err := writeSummary(summaryPath, []fileSummary{
+		{Path: "api/Containerfile", Summary: dockerfile.Summary{
+			Added:   []string{"org.opencontainers.image.title", "org.opencontainers.image.url"},
+			Updated: []string{"org.opencontainers.image.source"},
+			Removed: []string{"maintainer"},
+		}},
+		{Path: "web/Containerfile", Err: errors.New("bad syntax")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "- `api/Containerfile`\n" +
+		"  - Added `org.opencontainers.image.title`, `org.opencontainers.image.url`\n" +
+		"  - Updated `org.opencontainers.image.source`\n" +
+		"  - Removed `maintainer`\n" +
+		"- `web/Containerfile`\n" +
+		"  - Not updated: bad syntax\n"
+
+	contents, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, contents)
+	}
+
+	err = writeSummary(summaryPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	contents, err = os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "No image labels were changed.\n" {
+		t.Errorf("expected a note that nothing changed, got '%s'", contents)
 	}
 }
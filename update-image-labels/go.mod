@@ -4,7 +4,10 @@ go 1.26.0
 
 toolchain go1.26.6
 
-require github.com/sergi/go-diff v1.4.0
+require (
+	github.com/sergi/go-diff v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/BurntSushi/toml v1.4.1-0.20240526193622-a339e1f7089c // indirect
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the repo-level config file, read from the root of the repo.
+const FileName = ".tedium-labels.yml"
+
+// LabelNames are the labels that the chore derives values for, by their name within the org.opencontainers.image namespace.
+var LabelNames = []string{"title", "description", "documentation", "licenses", "source", "url", "vendor", "version", "revision", "created"}
+
+// defaultOff are the labels that are only managed when enabled, because they need build args.
+var defaultOff = []string{"revision", "created"}
+
+type Config struct {
+	Policy `yaml:",inline"`
+
+	// Exclude are gitignore-style patterns for Containerfiles to leave alone, on top of those ignored by git.
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// TitleFromImageName titles each image after the last part of its image.name label instead of the repo name.
+	TitleFromImageName bool `yaml:"titleFromImageName,omitempty"`
+
+	// Files override the policy for matching Containerfiles, in order.
+	Files []FileConfig `yaml:"files,omitempty"`
+}
+
+// Policy decides what happens to each label. Set, Strip and Keep use full label keys.
+type Policy struct {
+	// Labels enables or disables each derived label by name. Enabled labels are set (or blanked, without a value), and disabled ones are left
+	// alone.
+	Labels map[string]bool `yaml:"labels,omitempty"`
+
+	// Set are labels to set to a fixed value, taking precedence over derived values.
+	Set map[string]string `yaml:"set,omitempty"`
+
+	// Strip are labels to remove.
+	Strip []string `yaml:"strip,omitempty"`
+
+	// Keep are labels to leave alone, whatever else would happen to them.
+	Keep []string `yaml:"keep,omitempty"`
+}
+
+// FileConfig applies a policy to the Containerfiles matching Path (a glob relative to the repo root) or Image (their image.name label).
+type FileConfig struct {
+	Path   string `yaml:"path,omitempty"`
+	Image  string `yaml:"image,omitempty"`
+	Policy `yaml:",inline"`
+}
+
+// Enabled reports whether a derived label is managed.
+func (p Policy) Enabled(name string) bool {
+	if enabled, ok := p.Labels[name]; ok {
+		return enabled
+	}
+
+	return !slices.Contains(defaultOff, name)
+}
+
+// Merge returns a copy of p with other layered on top. Whatever other says about a label replaces what p says about it.
+func (p Policy) Merge(other Policy) Policy {
+	merged := Policy{
+		Labels: maps.Clone(p.Labels),
+		Set:    maps.Clone(p.Set),
+		Strip:  slices.Clone(p.Strip),
+		Keep:   slices.Clone(p.Keep),
+	}
+
+	if len(other.Labels) > 0 {
+		if merged.Labels == nil {
+			merged.Labels = map[string]bool{}
+		}
+		maps.Copy(merged.Labels, other.Labels)
+	}
+
+	for key, value := range other.Set {
+		merged.forget(key)
+		if merged.Set == nil {
+			merged.Set = map[string]string{}
+		}
+		merged.Set[key] = value
+	}
+
+	for _, key := range other.Strip {
+		merged.forget(key)
+		merged.Strip = append(merged.Strip, key)
+	}
+
+	for _, key := range other.Keep {
+		merged.forget(key)
+		merged.Keep = append(merged.Keep, key)
+	}
+
+	return merged
+}
+
+func (p *Policy) forget(key string) {
+	delete(p.Set, key)
+	p.Strip = slices.DeleteFunc(p.Strip, func(k string) bool { return k == key })
+	p.Keep = slices.DeleteFunc(p.Keep, func(k string) bool { return k == key })
+}
+
+// For returns the policy for a Containerfile, at relativePath from the repo root and with the given image.name label.
+func (c Config) For(relativePath string, imageName string) Policy {
+	policy := c.Policy
+
+	for _, f := range c.Files {
+		matched := false
+		if f.Path != "" {
+			matched, _ = path.Match(f.Path, relativePath)
+		}
+		if f.Image != "" && f.Image == imageName {
+			matched = true
+		}
+
+		if matched {
+			policy = policy.Merge(f.Policy)
+		}
+	}
+
+	return policy
+}
+
+// Merge returns a copy of c with other layered on top. Lists are appended, so that other's files take precedence.
+func (c Config) Merge(other Config) Config {
+	return Config{
+		Policy:             c.Policy.Merge(other.Policy),
+		Exclude:            append(append([]string{}, c.Exclude...), other.Exclude...),
+		TitleFromImageName: c.TitleFromImageName || other.TitleFromImageName,
+		Files:              append(append([]FileConfig{}, c.Files...), other.Files...),
+	}
+}
+
+// Load reads the config file at configPath. A missing file is not an error.
+func Load(configPath string) (Config, error) {
+	contents, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil
+	} else if err != nil {
+		return Config{}, fmt.Errorf("error reading %s: %w", configPath, err)
+	}
+
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("error parsing %s: %w", configPath, err)
+	}
+
+	err = config.Policy.validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("error parsing %s: %w", configPath, err)
+	}
+
+	for i, f := range config.Files {
+		if f.Path == "" && f.Image == "" {
+			return Config{}, fmt.Errorf("error parsing %s: file %d has no path or image", configPath, i)
+		}
+		if _, err := path.Match(f.Path, ""); err != nil {
+			return Config{}, fmt.Errorf("error parsing %s: invalid path '%s': %w", configPath, f.Path, err)
+		}
+
+		err = f.Policy.validate()
+		if err != nil {
+			return Config{}, fmt.Errorf("error parsing %s: %w", configPath, err)
+		}
+	}
+
+	return config, nil
+}
+
+func (p Policy) validate() error {
+	for name := range p.Labels {
+		if !slices.Contains(LabelNames, name) {
+			return fmt.Errorf("unknown label '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// FromEnv builds config from environment variables (in os.Environ format):
+//
+//   - EXCLUDE_PATHS - comma-separated exclude patterns
+//   - TEDIUM_LABEL_${NAME} - "true" or "false" to enable or disable a label, e.g. TEDIUM_LABEL_REVISION=true
+func FromEnv(environ []string) (Config, error) {
+	config := Config{}
+
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+
+		if key == "EXCLUDE_PATHS" {
+			for _, pattern := range strings.Split(value, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					config.Exclude = append(config.Exclude, pattern)
+				}
+			}
+			continue
+		}
+
+		name, ok := strings.CutPrefix(key, "TEDIUM_LABEL_")
+		if !ok {
+			continue
+		}
+
+		name = strings.ToLower(name)
+		if !slices.Contains(LabelNames, name) {
+			return Config{}, fmt.Errorf("unknown label in %s", key)
+		}
+
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("error parsing %s: %w", key, err)
+		}
+
+		if config.Labels == nil {
+			config.Labels = map[string]bool{}
+		}
+		config.Labels[name] = enabled
+	}
+
+	return config, nil
+}
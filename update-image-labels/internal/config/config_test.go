@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	actual, err := FromEnv([]string{
+		"HOME=/root",
+		"LABEL_FOO=bar",
+		"TEDIUM_LABEL_REVISION=true",
+		"TEDIUM_LABEL_VENDOR=false",
+		"EXCLUDE_PATHS=examples/, legacy/**",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Config{
+		Policy:  Policy{Labels: map[string]bool{"revision": true, "vendor": false}},
+		Exclude: []string{"examples/", "legacy/**"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	for _, entry := range []string{"TEDIUM_LABEL_FOO=true", "TEDIUM_LABEL_TITLE=maybe"} {
+		if _, err := FromEnv([]string{entry}); err == nil {
+			t.Errorf("expected an error for %s", entry)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	configPath := path.Join(t.TempDir(), FileName)
+
+	config, err := Load(configPath)
+	if err != nil || !reflect.DeepEqual(config, Config{}) {
+		t.Errorf("expected an empty config for a missing file, got %+v (%v)", config, err)
+	}
+
+	contents := `
+labels:
+  created: true
+strip:
+  - maintainer
+files:
+  - image: example/api
+    set:
+      org.opencontainers.image.title: api
+`
+	err = os.WriteFile(configPath, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Config{
+		Policy: Policy{Labels: map[string]bool{"created": true}, Strip: []string{"maintainer"}},
+		Files: []FileConfig{
+			{Image: "example/api", Policy: Policy{Set: map[string]string{"org.opencontainers.image.title": "api"}}},
+		},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	invalid := map[string]string{
+		"unknown label":       "labels:\n  foo: true\n",
+		"file with no target": "files:\n  - strip: [maintainer]\n",
+		"bad path":            "files:\n  - path: \"[\"\n",
+		"unknown field":       "foo: bar\n",
+	}
+
+	for name, contents := range invalid {
+		err = os.WriteFile(configPath, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Load(configPath); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	base := Policy{Labels: map[string]bool{"url": false, "created": true}}
+	merged := base.Merge(Policy{Labels: map[string]bool{"created": false}})
+
+	cases := map[string]bool{
+		"title":    true,
+		"url":      false,
+		"revision": false,
+		"created":  false,
+	}
+
+	for name, expected := range cases {
+		if actual := merged.Enabled(name); actual != expected {
+			t.Errorf("expected %s to be enabled=%v, got %v", name, expected, actual)
+		}
+	}
+
+	// merging must not mutate the inputs
+	if !base.Labels["created"] {
+		t.Error("merge mutated the base config")
+	}
+}
+
+func TestFor(t *testing.T) {
+	config := Config{
+		Policy: Policy{
+			Set:   map[string]string{"vendor": "Me", "maintainer": "me@example.com"},
+			Strip: []string{"legacy"},
+		},
+		Files: []FileConfig{
+			{Path: "images/*/Containerfile", Policy: Policy{Keep: []string{"vendor"}}},
+			{Image: "example/api", Policy: Policy{Set: map[string]string{"legacy": "yes"}, Strip: []string{"maintainer"}}},
+		},
+	}
+
+	cases := []struct {
+		Path     string
+		Image    string
+		Expected Policy
+	}{
+		{
+			Path:     "Containerfile",
+			Expected: config.Policy,
+		},
+		{
+			Path:  "images/web/Containerfile",
+			Image: "example/web",
+			Expected: Policy{
+				Set:   map[string]string{"maintainer": "me@example.com"},
+				Strip: []string{"legacy"},
+				Keep:  []string{"vendor"},
+			},
+		},
+		{
+			Path:  "images/api/Containerfile",
+			Image: "example/api",
+			Expected: Policy{
+				Set:   map[string]string{"legacy": "yes"},
+				Strip: []string{"maintainer"},
+				Keep:  []string{"vendor"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		actual := config.For(c.Path, c.Image)
+		if !reflect.DeepEqual(actual, c.Expected) {
+			t.Errorf("expected %+v for %s, got %+v", c.Expected, c.Path, actual)
+		}
+	}
+}
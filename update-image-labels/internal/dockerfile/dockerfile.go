@@ -0,0 +1,174 @@
+// Package dockerfile parses Dockerfiles and Containerfiles closely enough to edit them in place: every instruction is located by its byte offsets in
+// the source, so untouched lines can be written back exactly as they were.
+package dockerfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// File is a parsed Dockerfile.
+type File struct {
+	Source       []byte
+	Instructions []Instruction
+
+	// Escape is the escape character, set by an "# escape=" parser directive. It defaults to a backslash.
+	Escape byte
+}
+
+// Instruction is a single instruction, which may span several lines through continuations or heredocs.
+type Instruction struct {
+	// Command is the lower-case instruction name, e.g. "from" or "label".
+	Command string
+
+	// Start and End are the byte offsets of the instruction in the source, with End excluding the final line break.
+	Start int
+	End   int
+
+	// ArgsStart is the byte offset of the text following the instruction name.
+	ArgsStart int
+}
+
+var (
+	directivePattern = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.*?)\s*$`)
+	heredocPattern   = regexp.MustCompile(`<<(-?)(["']?)([a-zA-Z_][a-zA-Z0-9_]*)(["']?)`)
+)
+
+// line is a single physical line, by its byte offsets in the source. End excludes the line break.
+type line struct {
+	Start int
+	End   int
+}
+
+// Parse splits a Dockerfile into instructions.
+func Parse(source []byte) (*File, error) {
+	f := &File{Source: source, Escape: '\\'}
+
+	lines := splitLines(source)
+	directivesAllowed := true
+
+	for i := 0; i < len(lines); i++ {
+		text := f.text(lines[i])
+		trimmed := strings.TrimLeft(text, " \t")
+
+		// parser directives are only recognised before anything else, including blank lines and other comments
+		if trimmed == "" || trimmed[0] == '#' {
+			if directivesAllowed && trimmed != "" {
+				if m := directivePattern.FindStringSubmatch(trimmed); m != nil {
+					if strings.EqualFold(m[1], "escape") {
+						if m[2] != `\` && m[2] != "`" {
+							return nil, fmt.Errorf("invalid escape directive '%s' on line %d", m[2], i+1)
+						}
+						f.Escape = m[2][0]
+					}
+					continue
+				}
+			}
+			directivesAllowed = false
+			continue
+		}
+		directivesAllowed = false
+
+		instruction := Instruction{Start: lines[i].Start + len(text) - len(trimmed)}
+		nameLength := strings.IndexAny(trimmed, " \t")
+		if nameLength < 0 {
+			nameLength = len(trimmed)
+		}
+		instruction.Command = strings.ToLower(trimmed[:nameLength])
+		instruction.ArgsStart = instruction.Start + nameLength
+		instruction.End = lines[i].End
+
+		// continuation lines, skipping any comments or blank lines between them
+		current := text
+		for f.continues(current) && i+1 < len(lines) {
+			i++
+			current = f.text(lines[i])
+			if next := strings.TrimLeft(current, " \t"); next == "" || next[0] == '#' {
+				// keep the continuation going without letting the comment end it
+				current = string(f.Escape)
+				continue
+			}
+			instruction.End = lines[i].End
+		}
+
+		// heredoc bodies belong to the instruction, so nothing in them is mistaken for another instruction
+		if instruction.Command == "run" || instruction.Command == "copy" || instruction.Command == "add" {
+			for _, m := range heredocPattern.FindAllStringSubmatch(string(source[instruction.ArgsStart:instruction.End]), -1) {
+				if m[2] != m[4] {
+					continue
+				}
+
+				stripTabs := m[1] == "-"
+				terminated := false
+				for i+1 < len(lines) && !terminated {
+					i++
+					body := f.text(lines[i])
+					if stripTabs {
+						body = strings.TrimLeft(body, "\t")
+					}
+					terminated = body == m[3]
+				}
+				if !terminated {
+					return nil, fmt.Errorf("unterminated heredoc '%s' in %s on line %d", m[3], strings.ToUpper(instruction.Command), lineNumber(source, instruction.Start))
+				}
+				instruction.End = lines[i].End
+			}
+		}
+
+		f.Instructions = append(f.Instructions, instruction)
+	}
+
+	return f, nil
+}
+
+// FinalStage returns the instructions of the last build stage, from its FROM onwards.
+func (f *File) FinalStage() ([]Instruction, error) {
+	for i := len(f.Instructions) - 1; i >= 0; i-- {
+		if f.Instructions[i].Command == "from" {
+			return f.Instructions[i:], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no FROM instruction")
+}
+
+func (f *File) text(l line) string {
+	return string(f.Source[l.Start:l.End])
+}
+
+// continues reports whether a line ends with the escape character, continuing the instruction onto the next line.
+func (f *File) continues(text string) bool {
+	return strings.HasSuffix(strings.TrimRight(text, " \t\r"), string(f.Escape))
+}
+
+func splitLines(source []byte) []line {
+	lines := []line{}
+	start := 0
+	for start < len(source) {
+		end := start
+		for end < len(source) && source[end] != '\n' {
+			end++
+		}
+
+		next := end
+		if next < len(source) {
+			next++
+		}
+
+		// keep Windows line endings out of the text, but within the line's span
+		textEnd := end
+		if textEnd > start && source[textEnd-1] == '\r' {
+			textEnd--
+		}
+
+		lines = append(lines, line{Start: start, End: textEnd})
+		start = next
+	}
+
+	return lines
+}
+
+func lineNumber(source []byte, offset int) int {
+	return strings.Count(string(source[:offset]), "\n") + 1
+}
@@ -0,0 +1,45 @@
+package dockerfile
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	source := "# syntax=docker/dockerfile:1\r\n" +
+		"FROM golang AS builder\r\n" +
+		"  run echo a && \\\r\n" +
+		"\r\n" +
+		"    echo b\r\n" +
+		"COPY <<-EOF /etc/config\r\n" +
+		"\tFROM inside\r\n" +
+		"\tEOF\r\n" +
+		"\r\n" +
+		"from scratch\r\n" +
+		"CMD [\"/main\"]"
+
+	f, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	commands := []string{}
+	texts := []string{}
+	for _, i := range f.Instructions {
+		commands = append(commands, i.Command)
+		texts = append(texts, source[i.Start:i.End])
+	}
+
+	if expected := []string{"from", "run", "copy", "from", "cmd"}; !slices.Equal(commands, expected) {
+		t.Errorf("expected instructions %v, got %v", expected, commands)
+	}
+
+	if expected := "run echo a && \\\r\n\r\n    echo b"; texts[1] != expected {
+		t.Errorf("expected the continued instruction to be %q, got %q", expected, texts[1])
+	}
+
+	stage, err := f.FinalStage()
+	if err != nil || len(stage) != 2 || stage[0].Command != "from" {
+		t.Errorf("expected the final stage to start at the last FROM, got %+v (%v)", stage, err)
+	}
+}
@@ -0,0 +1,447 @@
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Label is a single key/value pair from a LABEL instruction, located by its byte offsets in the source.
+type Label struct {
+	Key   string
+	Value string
+
+	Start int
+	End   int
+}
+
+// word is a whitespace-separated argument with quotes and escapes processed. Eq is the index of the first unquoted "=" in Value, or -1.
+type word struct {
+	Value string
+	Eq    int
+	Start int
+	End   int
+}
+
+// Labels returns the pairs set by a LABEL instruction, in order.
+func (f *File) Labels(instruction Instruction) ([]Label, error) {
+	if instruction.Command != "label" {
+		return nil, fmt.Errorf("not a LABEL instruction")
+	}
+
+	words := f.words(instruction.ArgsStart, instruction.End)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("LABEL with no arguments on line %d", lineNumber(f.Source, instruction.Start))
+	}
+
+	// the legacy "LABEL key value" form sets a single label to the rest of the line
+	if words[0].Eq < 0 {
+		values := []string{}
+		for _, w := range words[1:] {
+			values = append(values, w.Value)
+		}
+		return []Label{{Key: words[0].Value, Value: strings.Join(values, " "), Start: words[0].Start, End: words[len(words)-1].End}}, nil
+	}
+
+	labels := []Label{}
+	for _, w := range words {
+		if w.Eq < 0 {
+			return nil, fmt.Errorf("LABEL argument '%s' is not a key=value pair on line %d", w.Value, lineNumber(f.Source, instruction.Start))
+		}
+		labels = append(labels, Label{Key: w.Value[:w.Eq], Value: w.Value[w.Eq+1:], Start: w.Start, End: w.End})
+	}
+
+	return labels, nil
+}
+
+// words splits the source between start and end into arguments, following line continuations and skipping the comments between them.
+func (f *File) words(start int, end int) []word {
+	src := f.Source
+	words := []word{}
+
+	var current *word
+	var value strings.Builder
+	var quote byte
+	eq := -1
+
+	finish := func(i int) {
+		if current != nil {
+			current.Value = value.String()
+			current.Eq = eq
+			current.End = i
+			words = append(words, *current)
+		}
+		current = nil
+		value.Reset()
+		eq = -1
+	}
+
+	for i := start; i < end; i++ {
+		c := src[i]
+
+		// a continuation joins the lines, along with any comment or blank lines after it
+		if c == f.Escape && quote != '\'' {
+			if next := skipContinuation(src, i, end); next > i {
+				i = next - 1
+				continue
+			}
+		}
+
+		switch {
+		case quote == 0 && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			finish(i)
+			continue
+		case current == nil:
+			current = &word{Start: i}
+		}
+
+		switch {
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote != 0 && c == quote:
+			quote = 0
+		case c == f.Escape && quote == 0 && i+1 < end:
+			i++
+			value.WriteByte(src[i])
+		case c == f.Escape && quote == '"' && i+1 < end:
+			// within double quotes, only quotes, variables and the escape itself can be escaped
+			i++
+			if next := src[i]; next != '"' && next != '$' && next != f.Escape {
+				value.WriteByte(c)
+			}
+			value.WriteByte(src[i])
+		case quote == 0 && c == '=' && eq < 0:
+			eq = value.Len()
+			value.WriteByte(c)
+		default:
+			value.WriteByte(c)
+		}
+	}
+	finish(end)
+
+	return words
+}
+
+// skipContinuation returns the offset after a continuation starting with the escape character at i, or i if there isn't one there.
+func skipContinuation(src []byte, i int, end int) int {
+	j := i + 1
+	for j < end && (src[j] == ' ' || src[j] == '\t' || src[j] == '\r') {
+		j++
+	}
+	if j >= end || src[j] != '\n' {
+		return i
+	}
+	j++
+
+	// comment and blank lines inside an instruction are ignored
+	for j < end {
+		lineEnd := j
+		for lineEnd < end && src[lineEnd] != '\n' {
+			lineEnd++
+		}
+		trimmed := bytes.TrimLeft(src[j:lineEnd], " \t\r")
+		if len(trimmed) > 0 && trimmed[0] != '#' {
+			break
+		}
+		j = min(lineEnd+1, end)
+	}
+
+	return j
+}
+
+var plainKey = regexp.MustCompile(`^[a-zA-Z0-9._/-]+$`)
+
+// Changes are the label changes to make to a Dockerfile, by label key.
+type Changes struct {
+	// Set are labels to set to a literal value.
+	Set map[string]string
+	// Args are labels to set to the value of a build arg, by the arg's name.
+	Args map[string]string
+	// Remove are labels to remove.
+	Remove []string
+}
+
+// Summary lists the keys of the labels that UpdateLabels changed.
+type Summary struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+// Empty reports whether nothing was changed.
+func (s Summary) Empty() bool {
+	return len(s.Added) == 0 && len(s.Updated) == 0 && len(s.Removed) == 0
+}
+
+// UpdateLabels changes labels in the final stage of a Dockerfile. Existing pairs are changed or removed in place, and missing ones are added after
+// the stage's last LABEL instruction (or at the end of the file). Everything else is left exactly as it was, and new lines follow the file's own
+// line endings.
+//
+// Labels set from build args have the arg declared in the final stage before their first use, if it isn't already.
+func UpdateLabels(source []byte, changes Changes) ([]byte, Summary, error) {
+	f, err := Parse(source)
+	if err != nil {
+		return nil, Summary{}, err
+	}
+
+	stage, err := f.FinalStage()
+	if err != nil {
+		return nil, Summary{}, err
+	}
+
+	newline := "\n"
+	if bytes.Contains(source, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+
+	type edit struct {
+		start int
+		end   int
+		text  string
+	}
+	edits := []edit{}
+	argEdits := []edit{}
+	summary := Summary{}
+	found := map[string]bool{}
+	declared := map[string]bool{}
+	lastLabelEnd := -1
+
+	// declare marks an arg as used by an instruction, returning whether it still needs declaring
+	declare := func(arg string) bool {
+		if declared[arg] {
+			return false
+		}
+		declared[arg] = true
+		return true
+	}
+
+	for _, instruction := range stage {
+		if instruction.Command == "arg" {
+			for _, w := range f.words(instruction.ArgsStart, instruction.End) {
+				name, _, _ := strings.Cut(w.Value, "=")
+				declared[name] = true
+			}
+			continue
+		}
+
+		if instruction.Command != "label" {
+			continue
+		}
+
+		pairs, err := f.Labels(instruction)
+		if err != nil {
+			return nil, Summary{}, err
+		}
+
+		lastKept := -1
+		for i, pair := range pairs {
+			if slices.Contains(changes.Remove, pair.Key) {
+				summary.Removed = append(summary.Removed, pair.Key)
+			} else {
+				lastKept = i
+			}
+		}
+
+		// an instruction left with nothing to set goes altogether, including its line break
+		if lastKept < 0 {
+			start := lineStart(source, instruction.Start)
+			end := lineBreakEnd(source, instruction.End)
+			if end == instruction.End && start > 0 {
+				// at the end of the file, take the line break before it instead
+				start = lineBreakStart(source, start)
+			}
+			edits = append(edits, edit{start: start, end: end})
+			continue
+		}
+		lastLabelEnd = instruction.End
+
+		for i, pair := range pairs {
+			if slices.Contains(changes.Remove, pair.Key) {
+				// removed pairs take the space up to the next pair with them, or the space before them at the end of the instruction
+				if i < lastKept {
+					edits = append(edits, edit{start: pair.Start, end: pairs[i+1].Start})
+				} else if i == lastKept+1 {
+					edits = append(edits, edit{start: pairs[lastKept].End, end: pairs[len(pairs)-1].End})
+				}
+				continue
+			}
+
+			if arg, ok := changes.Args[pair.Key]; ok {
+				found[pair.Key] = true
+				if declare(arg) {
+					start := lineStart(source, instruction.Start)
+					argEdits = append(argEdits, edit{start: start, end: start, text: "ARG " + arg + newline})
+				}
+				if pair.Value != "${"+arg+"}" && pair.Value != "$"+arg {
+					edits = append(edits, edit{start: pair.Start, end: pair.End, text: f.formatArgLabel(pair.Key, arg)})
+					summary.Updated = append(summary.Updated, pair.Key)
+				}
+				continue
+			}
+
+			value, ok := changes.Set[pair.Key]
+			if !ok {
+				continue
+			}
+			found[pair.Key] = true
+
+			if pair.Value != value {
+				edits = append(edits, edit{start: pair.Start, end: pair.End, text: f.formatLabel(pair.Key, value)})
+				summary.Updated = append(summary.Updated, pair.Key)
+			}
+		}
+	}
+
+	missing := []string{}
+	for key := range changes.Set {
+		if _, ok := changes.Args[key]; !ok && !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	for key := range changes.Args {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	slices.Sort(missing)
+	summary.Added = missing
+
+	if len(missing) > 0 {
+		added := []string{}
+		for _, key := range missing {
+			if arg, ok := changes.Args[key]; ok {
+				if declare(arg) {
+					added = append(added, "ARG "+arg)
+				}
+				added = append(added, "LABEL "+f.formatArgLabel(key, arg))
+			} else {
+				added = append(added, "LABEL "+f.formatLabel(key, changes.Set[key]))
+			}
+		}
+
+		if lastLabelEnd >= 0 {
+			edits = append(edits, edit{start: lastLabelEnd, end: lastLabelEnd, text: newline + strings.Join(added, newline)})
+		} else {
+			// separate the new labels from the rest of the file by a blank line, keeping the file's trailing line break (or lack of one)
+			text := ""
+			switch {
+			case !bytes.HasSuffix(source, []byte(newline)):
+				text = newline + newline + strings.Join(added, newline)
+			case !bytes.HasSuffix(source, []byte(newline+newline)):
+				text = newline + strings.Join(added, newline) + newline
+			default:
+				text = strings.Join(added, newline) + newline
+			}
+			edits = append(edits, edit{start: len(source), end: len(source), text: text})
+		}
+	}
+
+	// apply from the end, so that earlier offsets stay valid (and arg declarations land before anything else inserted at the same place)
+	edits = append(edits, argEdits...)
+	slices.SortStableFunc(edits, func(a edit, b edit) int {
+		return b.start - a.start
+	})
+
+	output := slices.Clone(source)
+	for _, e := range edits {
+		output = slices.Concat(output[:e.start], []byte(e.text), output[e.end:])
+	}
+
+	// a label can be set more than once
+	for _, keys := range []*[]string{&summary.Updated, &summary.Removed} {
+		slices.Sort(*keys)
+		*keys = slices.Compact(*keys)
+	}
+
+	return output, summary, nil
+}
+
+// FinalLabels returns the labels set in the final stage, with later values taking precedence.
+func (f *File) FinalLabels() (map[string]string, error) {
+	stage, err := f.FinalStage()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	for _, instruction := range stage {
+		if instruction.Command != "label" {
+			continue
+		}
+
+		pairs, err := f.Labels(instruction)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range pairs {
+			labels[pair.Key] = pair.Value
+		}
+	}
+
+	return labels, nil
+}
+
+// lineStart returns the offset of the start of the line containing offset.
+func lineStart(source []byte, offset int) int {
+	return bytes.LastIndexByte(source[:offset], '\n') + 1
+}
+
+// lineBreakStart returns the offset of the line break ending at offset.
+func lineBreakStart(source []byte, offset int) int {
+	if offset > 0 && source[offset-1] == '\n' {
+		offset--
+	}
+	if offset > 0 && source[offset-1] == '\r' {
+		offset--
+	}
+
+	return offset
+}
+
+// lineBreakEnd returns the offset after the line break at offset, if there is one.
+func lineBreakEnd(source []byte, offset int) int {
+	if offset < len(source) && source[offset] == '\r' {
+		offset++
+	}
+	if offset < len(source) && source[offset] == '\n' {
+		offset++
+	}
+
+	return offset
+}
+
+// formatLabel writes a key=value pair, quoting the value so that it's taken literally.
+func (f *File) formatLabel(key string, value string) string {
+	escape := string(f.Escape)
+
+	if !plainKey.MatchString(key) {
+		key = `"` + escapeQuoted(key, escape) + `"`
+	}
+
+	return key + `="` + escapeQuoted(value, escape) + `"`
+}
+
+// formatArgLabel writes a key=value pair that takes its value from a build arg.
+func (f *File) formatArgLabel(key string, arg string) string {
+	if !plainKey.MatchString(key) {
+		key = `"` + escapeQuoted(key, string(f.Escape)) + `"`
+	}
+
+	return key + `="${` + arg + `}"`
+}
+
+// escapeQuoted escapes the characters that are special within double quotes, including "$" which would otherwise start a variable.
+func escapeQuoted(value string, escape string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		switch string(r) {
+		case escape, `"`, "$":
+			sb.WriteString(escape)
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
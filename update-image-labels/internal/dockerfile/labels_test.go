@@ -0,0 +1,404 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func TestUpdateLabels(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    []string
+		Expected []string
+		Changes  Changes
+	}{
+		{
+			Name: "no labels",
+			Input: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+			},
+			Expected: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+			},
+			Changes: Changes{Set: map[string]string{}},
+		},
+
+		{
+			Name: "add a label",
+			Input: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+			},
+			Expected: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+				"",
+				"LABEL foo=\"bar\"",
+			},
+			Changes: Changes{Set: map[string]string{"foo": "bar"}},
+		},
+
+		{
+			Name: "update a label",
+			Input: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+				"",
+				"LABEL foo=\"bob\"",
+			},
+			Expected: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+				"",
+				"LABEL foo=\"bar\"",
+			},
+			Changes: Changes{Set: map[string]string{"foo": "bar"}},
+		},
+
+		{
+			Name: "merge labels",
+			Input: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+				"",
+				"LABEL fizz=\"buzz\"",
+				"",
+			},
+			Expected: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"RUN bar1",
+				"RUN bar2",
+				"",
+				"LABEL fizz=\"buzz\"",
+				"LABEL foo=\"bar\"",
+				"",
+			},
+			Changes: Changes{Set: map[string]string{"foo": "bar"}},
+		},
+
+		{
+			Name: "labels stay where they are",
+			Input: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"label foo2=\"bar\"",
+				"RUN bar1",
+				"LABEL foo1=\"bar\"",
+				"RUN bar2",
+			},
+			Expected: []string{
+				"FROM init",
+				"RUN something",
+				"LABEL earlier-stage=1",
+				"FROM foo",
+				"label foo2=\"bar\"",
+				"RUN bar1",
+				"LABEL foo1=\"bar\"",
+				"LABEL foo3=\"bar\"",
+				"RUN bar2",
+			},
+			Changes: Changes{Set: map[string]string{"foo3": "bar"}},
+		},
+
+		{
+			Name: "multiple pairs with continuations",
+			Input: []string{
+				"FROM foo",
+				"LABEL a=1 \\",
+				"  # a comment inside the instruction",
+				"  b=\"two words\" \\",
+				"  c=3",
+				"RUN bar",
+			},
+			Expected: []string{
+				"FROM foo",
+				"LABEL a=1 \\",
+				"  # a comment inside the instruction",
+				"  b=\"new value\" \\",
+				"  c=3",
+				"RUN bar",
+			},
+			Changes: Changes{Set: map[string]string{"b": "new value", "c": "3"}},
+		},
+
+		{
+			Name: "legacy form",
+			Input: []string{
+				"FROM foo",
+				"  LABEL description some long text",
+			},
+			Expected: []string{
+				"FROM foo",
+				"  LABEL description=\"other text\"",
+			},
+			Changes: Changes{Set: map[string]string{"description": "other text"}},
+		},
+
+		{
+			Name: "heredocs and comments",
+			Input: []string{
+				"FROM init",
+				"# LABEL foo=commented",
+				"RUN <<EOF",
+				"FROM not-a-stage",
+				"LABEL foo=not-a-label",
+				"EOF",
+				"LABEL foo=real",
+			},
+			Expected: []string{
+				"FROM init",
+				"# LABEL foo=commented",
+				"RUN <<EOF",
+				"FROM not-a-stage",
+				"LABEL foo=not-a-label",
+				"EOF",
+				"LABEL foo=\"bar\"",
+			},
+			Changes: Changes{Set: map[string]string{"foo": "bar"}},
+		},
+
+		{
+			Name: "escape directive",
+			Input: []string{
+				"# escape=`",
+				"FROM foo",
+				"LABEL a=\"x`\"y\" `",
+				"  b=2",
+			},
+			Expected: []string{
+				"# escape=`",
+				"FROM foo",
+				"LABEL a=\"x`\"y\" `",
+				"  b=\"`$HOME `\"quoted`\"\"",
+			},
+			Changes: Changes{Set: map[string]string{"a": `x"y`, "b": `$HOME "quoted"`}},
+		},
+
+		{
+			Name: "add labels from build args",
+			Input: []string{
+				"FROM foo",
+				"RUN bar",
+				"LABEL a=1",
+			},
+			Expected: []string{
+				"FROM foo",
+				"RUN bar",
+				"LABEL a=1",
+				"LABEL b=\"2\"",
+				"ARG IMAGE_REVISION",
+				"LABEL c=\"${IMAGE_REVISION}\"",
+			},
+			Changes: Changes{Set: map[string]string{"b": "2"}, Args: map[string]string{"c": "IMAGE_REVISION"}},
+		},
+
+		{
+			Name: "update labels from build args",
+			Input: []string{
+				"FROM foo",
+				"ARG IMAGE_CREATED",
+				"LABEL created=$IMAGE_CREATED",
+				"  LABEL a=1 \\",
+				"    revision=\"abc\"",
+			},
+			Expected: []string{
+				"FROM foo",
+				"ARG IMAGE_CREATED",
+				"LABEL created=$IMAGE_CREATED",
+				"ARG IMAGE_REVISION",
+				"  LABEL a=1 \\",
+				"    revision=\"${IMAGE_REVISION}\"",
+			},
+			Changes: Changes{Args: map[string]string{"created": "IMAGE_CREATED", "revision": "IMAGE_REVISION"}},
+		},
+
+		{
+			Name: "build args from earlier stages are redeclared",
+			Input: []string{
+				"ARG IMAGE_REVISION",
+				"FROM foo",
+			},
+			Expected: []string{
+				"ARG IMAGE_REVISION",
+				"FROM foo",
+				"",
+				"ARG IMAGE_REVISION",
+				"LABEL revision=\"${IMAGE_REVISION}\"",
+			},
+			Changes: Changes{Args: map[string]string{"revision": "IMAGE_REVISION"}},
+		},
+
+		{
+			Name: "remove labels",
+			Input: []string{
+				"FROM foo",
+				"LABEL gone=1",
+				"LABEL a=1 \\",
+				"  gone=2 \\",
+				"  b=2",
+				"  LABEL c=3 gone=3 \\",
+				"    gone=4",
+				"LABEL gone=5 gone=6",
+				"LABEL gone too",
+				"RUN bar",
+			},
+			Expected: []string{
+				"FROM foo",
+				"LABEL a=1 \\",
+				"  b=\"3\"",
+				"  LABEL c=3",
+				"LABEL d=\"4\"",
+				"RUN bar",
+			},
+			Changes: Changes{Set: map[string]string{"b": "3", "d": "4"}, Remove: []string{"gone"}},
+		},
+
+		{
+			Name: "remove every label",
+			Input: []string{
+				"FROM foo",
+				"LABEL gone=1",
+			},
+			Expected: []string{
+				"FROM foo",
+				"",
+				"LABEL a=\"1\"",
+			},
+			Changes: Changes{Set: map[string]string{"a": "1"}, Remove: []string{"gone"}},
+		},
+
+		{
+			Name: "keep the trailing line break",
+			Input: []string{
+				"FROM foo",
+				"",
+			},
+			Expected: []string{
+				"FROM foo",
+				"",
+				"LABEL a=\"1\"",
+				"",
+			},
+			Changes: Changes{Set: map[string]string{"a": "1"}},
+		},
+
+		{
+			Name: "windows line endings",
+			Input: []string{
+				"FROM foo\r",
+				"LABEL a=1\r",
+				"LABEL b=2\r",
+				"",
+			},
+			Expected: []string{
+				"FROM foo\r",
+				"LABEL a=1\r",
+				"ARG IMAGE_REVISION\r",
+				"LABEL b=\"${IMAGE_REVISION}\"\r",
+				"LABEL c=\"3\"\r",
+				"",
+			},
+			Changes: Changes{Set: map[string]string{"c": "3"}, Args: map[string]string{"b": "IMAGE_REVISION"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			output, _, err := UpdateLabels([]byte(strings.Join(c.Input, "\n")), c.Changes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			actual := string(output)
+			expected := strings.Join(c.Expected, "\n")
+			if actual != expected {
+				dmp := diffmatchpatch.New()
+				diffs := dmp.DiffMain(actual, expected, true)
+				t.Error("failed:\n" + dmp.DiffPrettyText(diffs))
+			}
+		})
+	}
+}
+
+func TestUpdateLabelsSummary(t *testing.T) {
+	input := "FROM foo\nLABEL a=1 b=2\nLABEL a=1 c=3 d=4\n"
+	changes := Changes{
+		Set:    map[string]string{"a": "2", "b": "2", "e": "5"},
+		Args:   map[string]string{"f": "IMAGE_CREATED"},
+		Remove: []string{"c", "d"},
+	}
+
+	_, summary, err := UpdateLabels([]byte(input), changes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Summary{Added: []string{"e", "f"}, Updated: []string{"a"}, Removed: []string{"c", "d"}}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+
+	_, summary, err = UpdateLabels([]byte(input), Changes{Set: map[string]string{"b": "2"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !summary.Empty() {
+		t.Errorf("expected no changes, got %+v", summary)
+	}
+}
+
+func TestUpdateLabelsErrors(t *testing.T) {
+	cases := map[string]string{
+		"no stage":           "RUN foo\n",
+		"unterminated":       "FROM foo\nRUN <<EOF\necho hi\n",
+		"bad escape":         "# escape=!\nFROM foo\n",
+		"not a pair":         "FROM foo\nLABEL a=1 b\n",
+		"label with no args": "FROM foo\nLABEL\n",
+	}
+
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := UpdateLabels([]byte(input), Changes{Set: map[string]string{"a": "2"}}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Package files finds the Containerfiles in a repo.
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+)
+
+// directories that hold other people's code rather than the repo's own images, so are pruned before descending into them
+var prunedDirNames = []string{
+	".git",
+	"node_modules",
+	"vendor",
+}
+
+// a directory containing this file is skipped entirely, along with everything below it, as it is by generate-tasks-and-ci
+const ignoreMarkerFileName = ".tedium-ignore"
+
+var (
+	containerFilePattern = regexp.MustCompile(`^(Containerfile|Dockerfile)(\..+)?$|^.+\.(Containerfile|Dockerfile)$`)
+
+	// per-file ignore files share the name of the file they're for
+	ignoreFilePattern = regexp.MustCompile(`\.(dockerignore|containerignore)$`)
+)
+
+// IsContainerFile reports whether a file name is a Containerfile or Dockerfile, including variants like Dockerfile.dev or api.Containerfile.
+func IsContainerFile(name string) bool {
+	return containerFilePattern.MatchString(name) && !ignoreFilePattern.MatchString(name)
+}
+
+// Find returns the Containerfiles in the repo at root, relative to it. Directories of dependencies and directories marked with a .tedium-ignore
+// file are skipped, along with anything ignored by .gitignore files, .git/info/exclude or the extra gitignore-style exclude patterns.
+//
+// Directories that can't be read are reported together once the walk is done, rather than stopping it.
+func Find(root string, exclude []string) ([]string, error) {
+	excludes := &IgnoreMatcher{}
+	excludes.AddPatterns("", exclude)
+
+	gitIgnores := &IgnoreMatcher{}
+	err := gitIgnores.AddFile("", path.Join(root, ".git", "info", "exclude"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading git exclude file: %w", err)
+	}
+
+	found := []string{}
+	errs := []error{}
+
+	err = fs.WalkDir(os.DirFS(root), ".", func(relativePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reading %s: %w", relativePath, err))
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if relativePath != "." {
+			if d.IsDir() && slices.Contains(prunedDirNames, d.Name()) {
+				return fs.SkipDir
+			}
+
+			if excludes.Match(relativePath, d.IsDir()) || gitIgnores.Match(relativePath, d.IsDir()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if d.IsDir() {
+				_, err := os.Stat(path.Join(root, relativePath, ignoreMarkerFileName))
+				if err == nil {
+					return fs.SkipDir
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					errs = append(errs, fmt.Errorf("error checking for ignore marker in %s: %w", relativePath, err))
+					return fs.SkipDir
+				}
+			}
+		}
+
+		if d.IsDir() {
+			err := gitIgnores.AddFile(relativePath, path.Join(root, relativePath, ".gitignore"))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error reading .gitignore in %s: %w", relativePath, err))
+			}
+			return nil
+		}
+
+		if IsContainerFile(d.Name()) {
+			found = append(found, relativePath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return found, errors.Join(errs...)
+}
@@ -0,0 +1,77 @@
+package files
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestIsContainerFile(t *testing.T) {
+	cases := map[string]bool{
+		"Containerfile":               true,
+		"Dockerfile":                  true,
+		"Dockerfile.dev":              true,
+		"Containerfile.arm64":         true,
+		"api.Containerfile":           true,
+		"worker.Dockerfile":           true,
+		"Dockerfile.dockerignore":     false,
+		"api.Dockerfile.dockerignore": false,
+		"Containerfiles":              false,
+		"my-Dockerfile":               false,
+		"README.md":                   false,
+	}
+
+	for name, expected := range cases {
+		if actual := IsContainerFile(name); actual != expected {
+			t.Errorf("expected %v for %s, got %v", expected, name, actual)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"Containerfile":                    "",
+		"api/Dockerfile.dev":               "",
+		"api/web.Containerfile":            "",
+		"node_modules/pkg/Dockerfile":      "",
+		"vendor/github.com/pkg/Dockerfile": "",
+		"internal/testdata/Containerfile":  "",
+		"e2e/fixtures/.tedium-ignore":      "",
+		"e2e/fixtures/Containerfile":       "",
+		"e2e/fixtures/nested/Dockerfile":   "",
+		"build/Containerfile":              "",
+		"examples/Containerfile":           "",
+		"web/.gitignore":                   "out/\n",
+		"web/out/Containerfile":            "",
+		".gitignore":                       "/build\n",
+		".git/info/exclude":                "scratch\n",
+		"scratch/Containerfile":            "",
+		".git/Containerfile":               "",
+	}
+
+	for name, contents := range files {
+		fullPath := path.Join(root, name)
+		err := os.MkdirAll(path.Dir(fullPath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(fullPath, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actual, err := Find(root, []string{"examples/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// testdata isn't skipped by name, only by the marker, as in generate-tasks-and-ci
+	expected := []string{"Containerfile", "api/Dockerfile.dev", "api/web.Containerfile", "internal/testdata/Containerfile"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,90 @@
+// Package labels works out the OCI image labels to set on a repo's Containerfiles.
+package labels
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/config"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/dockerfile"
+)
+
+// Prefix is the namespace of the labels that the chore derives.
+const Prefix = "org.opencontainers.image."
+
+// BuildArgs are the build args that labels only known at build time take their values from.
+var BuildArgs = map[string]string{
+	"revision": "IMAGE_REVISION",
+	"created":  "IMAGE_CREATED",
+}
+
+// For works out the changes for the Containerfile at relativePath from rootPath, which already sets the existing labels. Enabled labels without
+// a value are blanked, so that nothing is inherited from base images, and disabled labels are left out.
+func For(repo Repo, cfg config.Config, rootPath string, relativePath string, existing map[string]string) (dockerfile.Changes, error) {
+	imageName := existing["image.name"]
+	policy := cfg.For(relativePath, imageName)
+
+	// an image's own README describes it better than the repo's
+	description := ""
+	if dir := filepath.Dir(relativePath); dir != "." {
+		d, err := ReadmeDescription(filepath.Join(rootPath, dir))
+		if err != nil {
+			return dockerfile.Changes{}, err
+		}
+		description = d
+	}
+	if description == "" {
+		description = repo.Description
+	}
+
+	title := repo.Name
+	if cfg.TitleFromImageName && imageName != "" {
+		title = imageName[strings.LastIndex(imageName, "/")+1:]
+	}
+
+	url := repo.Homepage
+	if url == "" {
+		url = repo.WebURL
+	}
+
+	values := map[string]string{
+		"title":       title,
+		"description": description,
+		"licenses":    repo.License,
+		"source":      repo.WebURL,
+		"url":         url,
+	}
+
+	changes := dockerfile.Changes{Set: map[string]string{}, Args: map[string]string{}}
+	for _, name := range config.LabelNames {
+		if !policy.Enabled(name) {
+			continue
+		}
+
+		if arg, ok := BuildArgs[name]; ok {
+			changes.Args[Prefix+name] = arg
+		} else {
+			changes.Set[Prefix+name] = values[name]
+		}
+	}
+
+	for key, value := range policy.Set {
+		delete(changes.Args, key)
+		changes.Set[key] = value
+	}
+
+	for _, key := range policy.Strip {
+		delete(changes.Set, key)
+		delete(changes.Args, key)
+		changes.Remove = append(changes.Remove, key)
+	}
+
+	for _, key := range policy.Keep {
+		delete(changes.Set, key)
+		delete(changes.Args, key)
+		changes.Remove = slices.DeleteFunc(changes.Remove, func(k string) bool { return k == key })
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,90 @@
+package labels
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/config"
+	"github.com/markormesher/tedium-chores/update-image-labels/internal/dockerfile"
+)
+
+func TestFor(t *testing.T) {
+	root := t.TempDir()
+	imageDir := path.Join(root, "images", "api")
+	err := os.MkdirAll(imageDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(imageDir, "README.md"), []byte("# API\n\nThe API server.\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := Repo{Name: "project", WebURL: "https://git.example.com/me/project", Description: "A project.", License: "MIT"}
+	cfg := config.Config{Policy: config.Policy{Labels: map[string]bool{"vendor": false, "revision": true}}}
+
+	changes, err := For(repo, cfg, root, "images/api/Containerfile", map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := dockerfile.Changes{
+		Set: map[string]string{
+			"org.opencontainers.image.title":         "project",
+			"org.opencontainers.image.description":   "The API server.",
+			"org.opencontainers.image.documentation": "",
+			"org.opencontainers.image.licenses":      "MIT",
+			"org.opencontainers.image.source":        "https://git.example.com/me/project",
+			"org.opencontainers.image.url":           "https://git.example.com/me/project",
+			"org.opencontainers.image.version":       "",
+		},
+		Args: map[string]string{"org.opencontainers.image.revision": "IMAGE_REVISION"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+
+	// images at the root are described by the repo
+	changes, err = For(repo, cfg, root, "Containerfile", map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changes.Set["org.opencontainers.image.description"] != "A project." {
+		t.Errorf("expected the repo's description, got '%s'", changes.Set["org.opencontainers.image.description"])
+	}
+}
+
+func TestForWithPolicy(t *testing.T) {
+	cfg := config.Config{
+		Policy: config.Policy{
+			Set:   map[string]string{"org.opencontainers.image.revision": "fixed", "maintainer": "me"},
+			Strip: []string{"org.opencontainers.image.documentation", "legacy"},
+			Keep:  []string{"org.opencontainers.image.version"},
+		},
+		TitleFromImageName: true,
+		Files: []config.FileConfig{
+			{Image: "example/api", Policy: config.Policy{Labels: map[string]bool{"description": false, "source": false, "url": false, "licenses": false}}},
+		},
+	}
+
+	changes, err := For(Repo{Name: "project"}, cfg, t.TempDir(), "api/Containerfile", map[string]string{"image.name": "example/api"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := dockerfile.Changes{
+		Set: map[string]string{
+			"org.opencontainers.image.title":    "api",
+			"org.opencontainers.image.vendor":   "",
+			"org.opencontainers.image.revision": "fixed",
+			"maintainer":                        "me",
+		},
+		Args:   map[string]string{},
+		Remove: []string{"org.opencontainers.image.documentation", "legacy"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+}
@@ -0,0 +1,101 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// LicenseFileNames are checked in order for the repo's license.
+var LicenseFileNames = []string{"LICENSE.md", "LICENSE", "LICENSE.txt", "COPYING"}
+
+var (
+	spdxIdentifier = regexp.MustCompile(`(?m)SPDX-License-Identifier:\s*([A-Za-z0-9.+-]+)`)
+	// dots are kept within version numbers, but not at the end of sentences
+	nonWords = regexp.MustCompile(`[^a-z0-9.]+|\.+(?:[^a-z0-9]|$)`)
+)
+
+// licensePhrases identify a license by distinctive phrases from its text, after normalising to lower-case words. More specific licenses come
+// first, because some texts mention others (e.g. the LGPL and MPL refer to the GPL).
+var licensePhrases = []struct {
+	ID      string
+	Phrases []string
+	// GNU is set for licenses whose text doesn't say whether later versions are allowed, so the ID needs an -only or -or-later suffix that
+	// the repo must state separately.
+	GNU bool
+}{
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}, false},
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}, true},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}, true},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}, true},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}, true},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}, true},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}, false},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}, false},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name of"}, false},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}, false},
+	{"ISC", []string{"permission to use copy modify and or distribute this software for any purpose"}, false},
+	{"MIT", []string{"permission is hereby granted free of charge to any person obtaining a copy"}, false},
+}
+
+// ReadLicense detects the SPDX identifier of the license in the repo at rootPath, or returns an empty string if it can't be identified.
+func ReadLicense(rootPath string) (string, error) {
+	for _, name := range LicenseFileNames {
+		contents, err := os.ReadFile(path.Join(rootPath, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", name, err)
+		}
+
+		return DetectLicense(string(contents)), nil
+	}
+
+	return "", nil
+}
+
+// DetectLicense identifies a license from its text, preferring an explicit SPDX-License-Identifier line.
+func DetectLicense(text string) string {
+	if m := spdxIdentifier.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+
+	normalised := normalise(text)
+
+LicenseLoop:
+	for _, l := range licensePhrases {
+		for _, phrase := range l.Phrases {
+			if !strings.Contains(normalised, " "+phrase+" ") {
+				continue LicenseLoop
+			}
+		}
+
+		if l.GNU {
+			return gnuVariant(normalised, l.ID, l.Phrases[1])
+		}
+		return l.ID
+	}
+
+	return ""
+}
+
+// gnuVariant returns the ID with the suffix that the text states (e.g. "GPL-3.0-only" or "version 3 or later"), or an empty string if it
+// doesn't say. The license text itself only gives both options in its how-to-apply section, so it can't be used to pick one.
+func gnuVariant(normalised string, id string, version string) string {
+	for _, suffix := range []string{"-only", "-or-later"} {
+		for _, statement := range []string{normalise(id + suffix), " " + version + normalise(suffix)} {
+			if strings.Contains(normalised, statement) {
+				return id + suffix
+			}
+		}
+	}
+
+	return ""
+}
+
+func normalise(text string) string {
+	return " " + strings.TrimSpace(nonWords.ReplaceAllString(strings.ToLower(text), " ")) + " "
+}
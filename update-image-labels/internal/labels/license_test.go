@@ -0,0 +1,46 @@
+package labels
+
+import (
+	"testing"
+)
+
+func TestDetectLicense(t *testing.T) {
+	cases := map[string]string{
+		"spdx identifier": "// SPDX-License-Identifier: GPL-2.0-or-later\n\nGNU GENERAL PUBLIC LICENSE\nVersion 2, June 1991\n",
+		"agpl":            "# GNU AFFERO GENERAL PUBLIC LICENSE\n\nVersion 3, 19 November 2007\n\nThe GNU General Public License is...",
+		"lgpl 2.1":        "GNU LESSER GENERAL PUBLIC LICENSE\nVersion 2.1, February 1999\n\nsee the GNU General Public License, version 2.",
+		"gpl 2":           "GNU GENERAL PUBLIC LICENSE\n   Version 2, June 1991\n",
+		"gpl 3 only":      "This project is licensed under GPL-3.0-only.\n\nGNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\n",
+		"gpl 3 or later":  "Licensed under the GNU General Public License, version 3 or later.\n",
+		"apache":          "                                 Apache License\n                           Version 2.0, January 2004\n",
+		"mit": `MIT License
+
+Copyright (c) 2024 Someone
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal`,
+		"bsd 3":   "Redistribution and use in source and binary forms, with or without\nmodification, are permitted...\n3. Neither the name of the copyright holder...",
+		"unknown": "All rights reserved.",
+	}
+
+	expected := map[string]string{
+		"spdx identifier": "GPL-2.0-or-later",
+		"agpl":            "",
+		"lgpl 2.1":        "",
+		"gpl 2":           "",
+		"gpl 3 only":      "GPL-3.0-only",
+		"gpl 3 or later":  "GPL-3.0-or-later",
+		"apache":          "Apache-2.0",
+		"mit":             "MIT",
+		"bsd 3":           "BSD-3-Clause",
+		"unknown":         "",
+	}
+
+	for name, text := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := DetectLicense(text); actual != expected[name] {
+				t.Errorf("expected '%s', got '%s'", expected[name], actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package labels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Repo is what's known about the repo being updated, from Tedium's environment, the platform's API and the repo's own files.
+type Repo struct {
+	Name string
+	// WebURL is the repo's page on its platform.
+	WebURL string
+	// Homepage is the project's own website, if it has one.
+	Homepage    string
+	Description string
+	License     string
+}
+
+// Platform describes how to reach the repo on its platform, as given to chores by Tedium.
+type Platform struct {
+	Type       string
+	APIBaseURL string
+	Token      string
+	Owner      string
+	Repo       string
+}
+
+// PlatformFromEnv reads the platform from Tedium's environment variables.
+func PlatformFromEnv() Platform {
+	return Platform{
+		Type:       os.Getenv("TEDIUM_PLATFORM_TYPE"),
+		APIBaseURL: os.Getenv("TEDIUM_PLATFORM_API_BASE_URL"),
+		Token:      os.Getenv("TEDIUM_PLATFORM_TOKEN"),
+		Owner:      os.Getenv("TEDIUM_REPO_OWNER"),
+		Repo:       os.Getenv("TEDIUM_REPO_NAME"),
+	}
+}
+
+var (
+	httpClient = &http.Client{Timeout: time.Second * 15}
+
+	apiPathSuffix = regexp.MustCompile(`/api(/v[0-9]+)?/?$`)
+)
+
+// WebBaseURL derives the platform's web address from its API address, e.g. https://api.github.com to https://github.com or
+// https://git.example.com/api/v1 to https://git.example.com.
+func (p Platform) WebBaseURL() string {
+	url, err := neturl.Parse(p.APIBaseURL)
+	if err != nil || url.Host == "" {
+		return ""
+	}
+
+	url.Host = strings.TrimPrefix(url.Host, "api.")
+	url.Path = apiPathSuffix.ReplaceAllString(url.Path, "")
+	url.RawPath = ""
+
+	return strings.TrimSuffix(url.String(), "/")
+}
+
+// ReadRepo collects what's known about the repo at rootPath. Failing to reach the platform's API isn't an error, because everything from it
+// has a fallback.
+func ReadRepo(rootPath string, platform Platform) (Repo, error) {
+	repo := Repo{Name: platform.Repo}
+
+	if base := platform.WebBaseURL(); base != "" && platform.Owner != "" && platform.Repo != "" {
+		repo.WebURL = base + "/" + platform.Owner + "/" + platform.Repo
+	}
+
+	license, err := ReadLicense(rootPath)
+	if err != nil {
+		return Repo{}, err
+	}
+	repo.License = license
+
+	if platform.Token != "" && platform.Owner != "" && platform.Repo != "" {
+		details, err := platform.fetchRepo()
+		if err != nil {
+			slog.Warn("error fetching repo details; falling back to the repo's files", "error", err)
+		} else {
+			repo.Description = details.Description
+			repo.Homepage = details.Homepage
+			if details.WebURL != "" {
+				repo.WebURL = details.WebURL
+			}
+			if repo.License == "" && details.License.SPDXID != "NOASSERTION" {
+				repo.License = details.License.SPDXID
+			}
+		}
+	}
+
+	if repo.Description == "" {
+		description, err := ReadmeDescription(rootPath)
+		if err != nil {
+			return Repo{}, err
+		}
+		repo.Description = description
+	}
+
+	return repo, nil
+}
+
+// repoDetails covers the fields of both the GitHub/Gitea and GitLab APIs that are used.
+type repoDetails struct {
+	Description string `json:"description"`
+	HTMLURL     string `json:"html_url"`
+	WebURL      string `json:"web_url"`
+	Homepage    string `json:"homepage"`
+	Website     string `json:"website"`
+	License     struct {
+		SPDXID string `json:"spdx_id"`
+	} `json:"license"`
+}
+
+func (p Platform) fetchRepo() (repoDetails, error) {
+	var url string
+	switch p.Type {
+	case "github", "gitea":
+		url = fmt.Sprintf("%s/repos/%s/%s", strings.TrimSuffix(p.APIBaseURL, "/"), p.Owner, p.Repo)
+	case "gitlab":
+		url = fmt.Sprintf("%s/projects/%s", strings.TrimSuffix(p.APIBaseURL, "/"), neturl.PathEscape(p.Owner+"/"+p.Repo))
+	default:
+		return repoDetails{}, fmt.Errorf("unsupported platform type '%s'", p.Type)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return repoDetails{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return repoDetails{}, err
+	}
+
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			slog.Error("error closing request body", "error", err)
+		}
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return repoDetails{}, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return repoDetails{}, fmt.Errorf("got status %d from %s", resp.StatusCode, url)
+	}
+
+	var details repoDetails
+	err = json.Unmarshal(data, &details)
+	if err != nil {
+		return repoDetails{}, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	// normalise the platforms' different names
+	if details.WebURL == "" {
+		details.WebURL = details.HTMLURL
+	}
+	if details.Homepage == "" {
+		details.Homepage = details.Website
+	}
+
+	return details, nil
+}
+
+var (
+	// images, including badges that link elsewhere
+	markdownImage = regexp.MustCompile(`\[?!\[[^\]]*\]\([^)]*\)(\]\([^)]*\))?`)
+	markdownLink  = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	listItem      = regexp.MustCompile(`^([-*+]|\d+[.)])\s`)
+	sentenceEnd   = regexp.MustCompile(`[.!?]\s+[A-Z0-9]`)
+)
+
+// ReadmeDescription returns the first sentence of the first paragraph of text from the README.md in dir, skipping headings, badges, HTML,
+// lists, code blocks and paragraphs that introduce them, or an empty string if there isn't one.
+func ReadmeDescription(dir string) (string, error) {
+	contents, err := os.ReadFile(path.Join(dir, "README.md"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error reading README.md: %w", err)
+	}
+
+	for _, paragraph := range readmeParagraphs(string(contents)) {
+		description := strings.Join(paragraph, " ")
+		description = markdownLink.ReplaceAllString(description, "$1")
+		description = strings.NewReplacer("`", "", "**", "", "__", "").Replace(description)
+
+		// a paragraph leading into a list or code block doesn't make sense on its own
+		if strings.HasSuffix(description, ":") {
+			continue
+		}
+
+		if loc := sentenceEnd.FindStringIndex(description); loc != nil {
+			description = description[:loc[0]+1]
+		}
+
+		return description, nil
+	}
+
+	return "", nil
+}
+
+// readmeParagraphs splits a README into paragraphs of plain text lines.
+func readmeParagraphs(contents string) [][]string {
+	paragraphs := [][]string{}
+	paragraph := []string{}
+	inCodeBlock := false
+
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			paragraphs = append(paragraphs, paragraph)
+		}
+		paragraph = []string{}
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			endParagraph()
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+
+		line = strings.TrimSpace(markdownImage.ReplaceAllString(line, ""))
+
+		// headings, HTML, tables and lists aren't part of the description
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "<") || strings.HasPrefix(line, "|") || listItem.MatchString(line) {
+			endParagraph()
+			continue
+		}
+
+		// an underline turns the text above it into a heading
+		if strings.Trim(line, "=-") == "" {
+			paragraph = []string{}
+			continue
+		}
+
+		paragraph = append(paragraph, line)
+	}
+
+	endParagraph()
+
+	return paragraphs
+}
@@ -0,0 +1,67 @@
+package labels
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWebBaseURL(t *testing.T) {
+	cases := map[string]string{
+		"https://api.github.com":             "https://github.com",
+		"https://github.example.com/api/v3/": "https://github.example.com",
+		"https://git.example.com/api/v1":     "https://git.example.com",
+		"https://example.com/gitlab/api/v4":  "https://example.com/gitlab",
+		"":                                   "",
+	}
+
+	for apiBase, expected := range cases {
+		actual := Platform{APIBaseURL: apiBase}.WebBaseURL()
+		if actual != expected {
+			t.Errorf("expected '%s' for '%s', got '%s'", expected, apiBase, actual)
+		}
+	}
+}
+
+func TestReadmeDescription(t *testing.T) {
+	cases := map[string]string{
+		"title and badges":  "# Project\n\n[![CI](https://ci/badge.svg)](https://ci) ![Go](https://go/badge.svg)\n\nThis [Tedium](https://tedium) chore\nupdates `Containerfile`s.\n\nMore details.\n",
+		"underlined title":  "Project\n=======\n\n<p align=\"center\">logo</p>\nA **small** tool.\n",
+		"no paragraph":      "# Project\n",
+		"several sentences": "# Project\n\nA small tool, e.g. for testing. It does things.\n",
+		"list intro":        "# Project\n\nThis tool does the following:\n\n- one thing\n- another thing\n\n```\nexample\n```\n\nIt is small.\n",
+		"only a list intro": "# Project\n\nThis tool does the following:\n\n1. one thing\n2. another thing\n",
+	}
+
+	expected := map[string]string{
+		"title and badges":  "This Tedium chore updates Containerfiles.",
+		"underlined title":  "A small tool.",
+		"no paragraph":      "",
+		"several sentences": "A small tool, e.g. for testing.",
+		"list intro":        "It is small.",
+		"only a list intro": "",
+	}
+
+	for name, contents := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(path.Join(dir, "README.md"), []byte(contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := ReadmeDescription(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != expected[name] {
+				t.Errorf("expected '%s', got '%s'", expected[name], actual)
+			}
+		})
+	}
+
+	actual, err := ReadmeDescription(t.TempDir())
+	if err != nil || actual != "" {
+		t.Errorf("expected nothing for a missing README, got '%s' (%v)", actual, err)
+	}
+}